@@ -0,0 +1,64 @@
+package rplog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxJSONAttrBytes caps the size of a value marshaled by JSON.
+const maxJSONAttrBytes = 16 << 10
+
+// JSON returns an Attr whose value is v marshaled as JSON, so that slices, maps, and structs are embedded in the log as native JSON
+// rather than as Go-formatted strings.
+// Values that fail to marshal or are larger than 16KiB are replaced by a string describing the problem.
+func JSON(key string, v any) slog.Attr {
+	b, err := json.Marshal(v)
+	switch {
+	case err != nil:
+		return slog.String(key, fmt.Sprintf("!ERROR: json.Marshal: %v", err))
+	case len(b) > maxJSONAttrBytes:
+		n := 256
+		for n > 0 && !utf8.RuneStart(b[n]) { // don't split a rune: the excerpt must stay valid UTF-8.
+			n--
+		}
+		return slog.String(key, fmt.Sprintf("!TRUNCATED: %d bytes exceeds limit of %d: %s...", len(b), maxJSONAttrBytes, b[:n]))
+	}
+	return slog.Any(key, json.RawMessage(b))
+}
+
+// plainValue converts a's value to one that encoding/json renders as it would be logged: redacted (see SetRedactPatterns), with groups as objects.
+// Use it for attributes that are written other than through the handler's ReplaceAttr.
+func plainValue(a slog.Attr) any {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return redact(nil, a).Value.Any()
+	}
+	m := make(map[string]any, len(a.Value.Group()))
+	for _, a := range a.Value.Group() {
+		m[a.Key] = plainValue(a)
+	}
+	return m
+}
+
+// Lazy returns an Attr whose value is computed by fn only if a record carrying it is actually written:
+// after the level and sampling checks (see trace.WithSampleRate), which drop records before their attributes are resolved.
+// Use it for attributes that are expensive to compute. fn is called at most once, even if the attribute is resolved repeatedly.
+//
+//	slog.DebugContext(ctx, "cache state", rplog.Lazy("entries", func() any { return cache.Dump() }))
+func Lazy(key string, fn func() any) slog.Attr {
+	return slog.Any(key, &lazyValuer{fn: fn})
+}
+
+type lazyValuer struct {
+	once sync.Once
+	fn   func() any
+	v    slog.Value
+}
+
+func (l *lazyValuer) LogValue() slog.Value {
+	l.once.Do(func() { l.v = slog.AnyValue(l.fn()) })
+	return l.v
+}
@@ -0,0 +1,29 @@
+package rplog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestJSON(t *testing.T) {
+	if got := JSON("k", map[string]int{"a": 1}); string(got.Value.Any().(json.RawMessage)) != `{"a":1}` {
+		t.Errorf("JSON = %v, want the raw JSON", got.Value)
+	}
+
+	got := JSON("k", make(chan int)).Value.String()
+	if !strings.HasPrefix(got, "!ERROR: json.Marshal: ") {
+		t.Errorf("JSON of a channel = %q, want the marshal error", got)
+	}
+
+	// the opening quote puts every 'é' at an odd offset: a 256-byte excerpt would end mid-rune.
+	big := strings.Repeat("é", maxJSONAttrBytes)
+	got = JSON("k", big).Value.String()
+	if !strings.HasPrefix(got, "!TRUNCATED: 32770 bytes exceeds limit of 16384: \"é") || len(got) > 512 {
+		t.Errorf("JSON of %d bytes = %q, want it truncated", len(big), got)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncated JSON is not valid UTF-8: %q", got)
+	}
+}
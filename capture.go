@@ -0,0 +1,66 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogRecord is a record captured by Capture.
+type LogRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   []slog.Attr // the record's attributes, including those the Handler adds (log_id, trace_id, and so on), with LogValuers resolved.
+}
+
+// Attr returns the value of the record's attribute with the given key, and whether it has one.
+func (r LogRecord) Attr(key string) (slog.Value, bool) {
+	for _, a := range r.Attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+// capture holds the records captured by Capture.
+type capture struct {
+	mu      sync.Mutex
+	records []LogRecord
+	done    bool // fn has returned: stop capturing, even if goroutines outlive it.
+}
+
+// Capture calls fn, returning the records logged with fn's context (or a context derived from it) by the Handler while fn runs,
+// for a test or an admin endpoint to inspect exactly what an operation logged. The records are still written as usual.
+// Records logged from goroutines fn starts are captured until fn returns.
+// Attributes added via slog.Logger.With aren't captured, and neither are records below the configured level.
+// Records accumulated by Consolidate are captured as they become events, without the Trace and other attributes the Handler adds.
+func Capture(ctx context.Context, fn func(context.Context)) []LogRecord {
+	c := &capture{}
+	fn(context.WithValue(ctx, ctxKey[*capture]{}, c))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	return c.records
+}
+
+// captureRecord adds r to the capture in ctx, if there is one. The record isn't retained: its contents are copied out.
+func captureRecord(ctx context.Context, r slog.Record) {
+	c, ok := ctx.Value(ctxKey[*capture]{}).(*capture)
+	if !ok {
+		return
+	}
+	lr := LogRecord{Time: r.Time, Level: r.Level, Message: r.Message, Attrs: make([]slog.Attr, 0, r.NumAttrs())}
+	r.Attrs(func(a slog.Attr) bool {
+		a.Value = a.Value.Resolve()
+		lr.Attrs = append(lr.Attrs, a)
+		return true
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.done {
+		c.records = append(c.records, lr)
+	}
+}
@@ -0,0 +1,116 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LogConfig logs cfg, a struct (or pointer to one) holding the configuration the service started with, at INFO,
+// with its exported fields as attributes in the `config` group, so that "what settings was this instance running with" can be answered from the logs.
+// Nested structs become nested groups. Field names are converted to snake_case, and can be controlled with the `log` tag:
+//
+//	type Config struct {
+//		Port     int                            // config.port
+//		DBURL    string `log:"database_url"`    // config.database_url
+//		Password string `log:"redact"`          // config.password: "[REDACTED]"
+//		APIKey   string `log:"api_key,redact"`  // config.api_key: "[REDACTED]"
+//		Internal string `log:"-"`               // omitted
+//	}
+//
+// Only the fields themselves are redacted: redact a struct field to hide a struct, not a field of a struct in a slice or map.
+// Only structs from cfg's own package are walked: others, like an *http.Client or *tls.Config, are formatted with %v.
+// A pointer back to a struct being walked is logged as "<cycle>", and structs nested more than configMaxDepth deep as "<truncated>".
+func LogConfig(ctx context.Context, cfg any) {
+	w := configWalker{seen: make(map[uintptr]bool)}
+	if t := reflect.TypeOf(cfg); t != nil {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		w.pkg = t.PkgPath()
+	}
+	logAt(ctx, 1, slog.LevelInfo, "config", slog.Attr{Key: "config", Value: w.value(reflect.ValueOf(cfg), 0)})
+}
+
+// configMaxDepth is how deep LogConfig walks nested structs.
+const configMaxDepth = 8
+
+// configWalker converts a configuration to a slog.Value for LogConfig.
+type configWalker struct {
+	pkg  string           // the package of the configuration's type: structs from other packages aren't walked.
+	seen map[uintptr]bool // the pointers followed to reach the current value, to detect cycles.
+}
+
+// value returns v as a slog.Value: a group of its exported fields if it's a struct of the configuration's package, or else its value.
+func (w *configWalker) value(v reflect.Value, depth int) slog.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		if v.Kind() == reflect.Pointer {
+			p := v.Pointer()
+			if w.seen[p] {
+				return slog.StringValue("<cycle>")
+			}
+			w.seen[p] = true
+			defer delete(w.seen, p) // only the current path counts: a pointer shared by two fields is logged under both.
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+	if v.Kind() != reflect.Struct || v.Type() == reflect.TypeOf(time.Time{}) {
+		return slog.AnyValue(v.Interface())
+	}
+	if pkg := v.Type().PkgPath(); pkg != "" && pkg != w.pkg {
+		return slog.StringValue(fmt.Sprintf("%v", v.Interface()))
+	}
+	if depth >= configMaxDepth {
+		return slog.StringValue("<truncated>")
+	}
+	var attrs []slog.Attr
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opt, _ := strings.Cut(f.Tag.Get("log"), ",")
+		if name == "redact" && opt == "" {
+			name, opt = "", "redact"
+		}
+		switch {
+		case name == "-":
+			continue
+		case name == "":
+			name = snakeCase(f.Name)
+		}
+		if opt == "redact" {
+			attrs = append(attrs, slog.String(name, redacted))
+			continue
+		}
+		attrs = append(attrs, slog.Attr{Key: name, Value: w.value(v.Field(i), depth+1)})
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// snakeCase converts a Go identifier to snake_case, keeping initialisms together: "DBURL" -> "dburl", "HTTPPort" -> "http_port", "MaxRetries" -> "max_retries".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package rplog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"Port":       "port",
+		"MaxRetries": "max_retries",
+		"DBURL":      "dburl",
+		"HTTPPort":   "http_port",
+		"UserID":     "user_id",
+		"V2API":      "v2_api",
+		"Ünïcode":    "ünïcode",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+type testDB struct {
+	URL      string
+	Password string `log:"redact"`
+}
+
+type testConfig struct {
+	Port     int
+	DBURL    string `log:"database_url"`
+	Password string `log:"redact"`
+	APIKey   string `log:"api_key,redact"`
+	Internal string `log:"-"`
+	Timeout  time.Duration
+	Started  time.Time
+	DB       testDB
+	Replica  *testDB
+	Backup   *testDB
+	Client   *http.Client
+	Next     *testConfig
+	private  string
+}
+
+func TestLogConfig(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	cfg := &testConfig{
+		Port: 8080, DBURL: "postgres://db", Password: "hunter2", APIKey: "k", Internal: "x", Timeout: time.Second,
+		Started: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		DB:      testDB{URL: "primary", Password: "p"},
+		Replica: &testDB{URL: "replica"},
+		Client:  &http.Client{Timeout: time.Second},
+		private: "x",
+	}
+	cfg.Next = cfg
+	got := logJSON(t, &buf, func() { LogConfig(context.Background(), cfg) })
+	want := map[string]any{
+		"port":         8080.0,
+		"database_url": "postgres://db",
+		"password":     redacted,
+		"api_key":      redacted,
+		"timeout":      float64(time.Second),
+		"started":      "2024-01-02T03:04:05Z",
+		"db":           map[string]any{"url": "primary", "password": redacted},
+		"replica":      map[string]any{"url": "replica", "password": redacted},
+		"backup":       nil,
+		"next":         "<cycle>",
+	}
+	config, _ := got["config"].(map[string]any)
+	if _, ok := config["client"].(string); !ok {
+		t.Errorf("config.client = %v, want it formatted, not walked", config["client"])
+	}
+	delete(config, "client")
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %v, want %v", got["config"], want)
+	}
+}
+
+// configChain nests itself configMaxDepth deep and beyond, without a cycle.
+type configChain struct{ Next *configChain }
+
+func TestLogConfigDepth(t *testing.T) {
+	var c *configChain
+	for i := 0; i < 2*configMaxDepth; i++ {
+		c = &configChain{Next: c}
+	}
+	w := configWalker{pkg: "github.com/runpod/rplog", seen: make(map[uintptr]bool)}
+	v := w.value(reflect.ValueOf(c), 0)
+	for depth := 0; depth < configMaxDepth; depth++ {
+		if v.Kind() != slog.KindGroup {
+			t.Fatalf("depth %d: got %v, want a group", depth, v)
+		}
+		v = v.Group()[0].Value
+	}
+	if v.String() != "<truncated>" {
+		t.Errorf("at configMaxDepth: got %v, want <truncated>", v)
+	}
+}
@@ -0,0 +1,97 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/runpod/rplog/trace"
+)
+
+// Consolidate is a middleware that logs one record per request rather than one per call: records below WARN logged with the request's context
+// are accumulated instead of written, and when the request completes they're written as a single INFO record, "request completed",
+// with the accumulated records in its `events` array (each an object with the time, level, msg, and the record's own attributes)
+// and any calls made via trace.ClientMiddleware in its `downstream_calls` array (see trace.DownstreamCalls), which trace.ServerMiddleware then doesn't log separately.
+// Records at WARN or above are still written immediately, as are any logged after the request completes.
+// It trades per-record granularity for volume: use it for high-volume services where one rich line per request is enough.
+//
+// Most attributes added via slog.Logger.With aren't carried into the events: only those added after slog.Logger.WithGroup, or holding LogValuers, are.
+// The events are redacted, and their keys converted as the record's own are (see RUNPOD_LOG_KEY_CASE). The record hook (see SetRecordHook) and Capture
+// see each accumulated record as it becomes an event: without the log_id, Trace, and other attributes the Handler adds, which the consolidated record carries. A request that logged nothing gets an empty `events` array.
+// This middleware should come after trace.ServerMiddleware, so that the consolidated record has the Trace:
+//
+//	http.ListenAndServe(":8080", trace.ServerMiddleware(rplog.Consolidate(h)))
+func Consolidate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acc := &accumulator{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey[*accumulator]{}, acc)))
+		acc.mu.Lock()
+		events := acc.events
+		acc.done = true
+		acc.mu.Unlock()
+		if events == nil {
+			events = []map[string]any{} // [], not null.
+		}
+		attrs := []any{slog.Any("events", events)}
+		if calls, dropped := trace.DownstreamCalls(r.Context()); len(calls) > 0 {
+			attrs = append(attrs, slog.Any("downstream_calls", calls), slog.Int("downstream_calls_dropped", dropped))
+			trace.MarkDownstreamCallsLogged(r.Context()) // so that trace.ServerMiddleware doesn't log them again.
+		}
+		logPC(r.Context(), callerPC(0), slog.LevelInfo, "request completed", attrs...)
+	})
+}
+
+// accumulator holds the records of a request under Consolidate.
+type accumulator struct {
+	mu     sync.Mutex
+	events []map[string]any
+	done   bool // the request has completed: records are written as usual.
+}
+
+// accumulatorFor returns the accumulator in ctx, if there is one and r is below WARN: the records Consolidate accumulates.
+func accumulatorFor(ctx context.Context, r slog.Record) (*accumulator, bool) {
+	acc, ok := ctx.Value(ctxKey[*accumulator]{}).(*accumulator)
+	return acc, ok && r.Level < slog.LevelWarn
+}
+
+// add adds r to the accumulator, reporting whether it did so: once the request has completed, it doesn't.
+// The record isn't retained: its contents are copied out, with their keys converted by conv, if it's not nil.
+func (acc *accumulator) add(r slog.Record, conv func(string) string) bool {
+	event := make(map[string]any, 3+r.NumAttrs())
+	add := func(a slog.Attr) {
+		if conv != nil {
+			a = convertAllKeys(conv, a)
+		}
+		event[a.Key] = plainValue(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(a)
+		return true
+	})
+	add(slog.Time(slog.TimeKey, r.Time.UTC()))
+	add(slog.String(slog.LevelKey, r.Level.String()))
+	add(slog.String(slog.MessageKey, r.Message))
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	if acc.done {
+		return false
+	}
+	acc.events = append(acc.events, event)
+	return true
+}
+
+// convertAllKeys converts the key of a, and of every attribute in its groups, via conv: unlike the record's own attributes, events never pass through ReplaceAttr.
+func convertAllKeys(conv func(string) string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	a.Key = conv(a.Key)
+	if a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+	group := a.Value.Group()
+	converted := make([]slog.Attr, len(group))
+	for i, ga := range group {
+		converted[i] = convertAllKeys(conv, ga)
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(converted...)}
+}
@@ -0,0 +1,109 @@
+package rplog
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// InitCSV is like Init, but writes records to w as CSV, for opening a short run (a load test, a one-off job) in a spreadsheet.
+// It's meant for ad-hoc analysis, not production.
+//
+// The columns are fixed: InitCSV writes them as a header row, and each record becomes a row with the values of those columns,
+// leaving a cell empty if the record doesn't have the attribute. Attributes in groups are named by their dotted path (e.g, "http.method"),
+// and the builtin time, level, msg, and source are available as columns of those names. Any other attributes are dropped.
+// As with Init, it's OK to use nil for the metadata.
+//
+// Example Usage:
+//
+//	rplog.InitCSV(f, []string{"time", "level", "msg", "trace_id", "http.path", "request_elapsed_ms"}, nil)
+func InitCSV(w io.Writer, columns []string, m *Metadata) {
+	out := &csvOut{w: csv.NewWriter(w), columns: columns}
+	out.write(columns)
+	initHandler(m, func(opts *slog.HandlerOptions) slog.Handler { return &csvHandler{opts: *opts, out: out} })
+	health.sink.Store("csv")
+	health.proto.Store(nil)
+}
+
+// csvOut is the destination of a csvHandler and those derived from it.
+type csvOut struct {
+	mu      sync.Mutex
+	w       *csv.Writer
+	columns []string
+}
+
+func (o *csvOut) write(row []string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w.Write(row)
+	o.w.Flush()
+	return o.w.Error()
+}
+
+// csvHandler is a slog.Handler writing records as CSV rows of fixed columns.
+type csvHandler struct {
+	opts   slog.HandlerOptions
+	groups []string   // currently open groups, for ReplaceAttr.
+	attrs  []flatAttr // preformatted by WithAttrs.
+	out    *csvOut
+}
+
+func (h *csvHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	minLvl := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLvl = h.opts.Level.Level()
+	}
+	return lvl >= minLvl
+}
+
+func (h *csvHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = flattenAttrs(h.attrs[:len(h.attrs):len(h.attrs)], h.opts.ReplaceAttr, h.groups, attrs)
+	return &h2
+}
+
+func (h *csvHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+func (h *csvHandler) Handle(_ context.Context, r slog.Record) error {
+	builtins := []slog.Attr{slog.Any(slog.LevelKey, r.Level), slog.String(slog.MessageKey, r.Message)}
+	if h.opts.AddSource && r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		builtins = append(builtins, slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", f.File, f.Line)))
+	}
+	attrs := flattenAttrs(nil, h.opts.ReplaceAttr, nil, builtins)
+	t := slog.Time(slog.TimeKey, r.Time)
+	if h.opts.ReplaceAttr != nil {
+		t = h.opts.ReplaceAttr(nil, t)
+	}
+	if t.Value.Kind() == slog.KindTime { // RFC 3339 rather than time.Time.String, which spreadsheets don't recognize.
+		t.Value = slog.StringValue(t.Value.Time().Format(time.RFC3339Nano))
+	}
+	attrs = flattenAttrs(attrs, nil, nil, []slog.Attr{t})
+	attrs = append(attrs, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = flattenAttrs(attrs, h.opts.ReplaceAttr, h.groups, []slog.Attr{a})
+		return true
+	})
+
+	vals := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		vals[a.key] = a.val
+	}
+	row := make([]string, len(h.out.columns))
+	for i, col := range h.out.columns {
+		row[i] = vals[col]
+	}
+	return h.out.write(row)
+}
@@ -0,0 +1,34 @@
+package rplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/runpod/rplog/trace"
+)
+
+func TestInitCSV(t *testing.T) {
+	var buf bytes.Buffer
+	InitCSV(&buf, []string{"level", "msg", "http.method", "missing"}, nil)
+	ctx := trace.WithRequestInfo(context.Background(), trace.RequestInfo{Method: "GET", Path: "/"})
+	slog.WarnContext(ctx, "hello, world")
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"level", "msg", "http.method", "missing"}, {"INFO", "rplog initialized", "", ""}, {"WARN", "hello, world", "GET", ""}}
+	if len(rows) < 3 {
+		t.Fatalf("got rows %q, want %q", rows, want)
+	}
+	rows = append(rows[:2], rows[len(rows)-1]) // skip any GOMAXPROCS warning.
+	for i := range want {
+		if !slices.Equal(rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WarnOnDeadline logs a warning, with the Trace from ctx, if ctx is still active within threshold of its deadline,
+// surfacing operations at risk of timing out before they fail. Call the returned function when the operation finishes:
+// the background goroutine exits then, after warning, or when ctx is done, whichever comes first.
+// If ctx has no deadline, nothing is started.
+//
+//	done := rplog.WarnOnDeadline(ctx, 2*time.Second)
+//	defer done()
+func WarnOnDeadline(ctx context.Context, threshold time.Duration) (done func()) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return func() {}
+	}
+	pc := callerPC(1)
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTimer(time.Until(deadline) - threshold)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			if ctx.Err() == nil {
+				logPC(ctx, pc, slog.LevelWarn, "context deadline approaching",
+					slog.Int64("deadline_remaining_ms", time.Until(deadline).Milliseconds()), slog.Duration("threshold", threshold))
+			}
+		case <-ctx.Done():
+		case <-stop:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
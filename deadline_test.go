@@ -0,0 +1,85 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// recordDefault sends slog's default logger to a recorder for the rest of the test.
+func recordDefault(t *testing.T) *recorder {
+	rec := &recorder{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(rec))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return rec
+}
+
+// waitGoroutines fails t unless the number of goroutines drops to at most n within a second.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	for start := time.Now(); runtime.NumGoroutine() > n; time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("%d goroutines, want at most %d: WarnOnDeadline leaked one", runtime.NumGoroutine(), n)
+		}
+	}
+}
+
+func TestWarnOnDeadline(t *testing.T) {
+	rec := recordDefault(t)
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	done := WarnOnDeadline(ctx, 150*time.Millisecond)
+	defer done()
+
+	if n := runtime.NumGoroutine(); n <= before {
+		t.Fatalf("%d goroutines after WarnOnDeadline, want more than %d", n, before)
+	}
+	time.Sleep(100 * time.Millisecond)
+	waitGoroutines(t, before) // it exits after warning, without done.
+	got := rec.get()
+	if len(got) != 1 || got[0].Message != "context deadline approaching" || got[0].Level != slog.LevelWarn {
+		t.Fatalf("got %v, want one warning", got)
+	}
+	if ms := attrsOf(got[0])["deadline_remaining_ms"].Int64(); ms <= 0 || ms > 150 {
+		t.Errorf("deadline_remaining_ms = %d, want within the threshold", ms)
+	}
+}
+
+func TestWarnOnDeadlineWithoutDeadline(t *testing.T) {
+	rec := recordDefault(t)
+	before := runtime.NumGoroutine()
+	done := WarnOnDeadline(context.Background(), time.Hour)
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines after WarnOnDeadline, want %d: a context without a deadline needs none", n, before)
+	}
+	done()
+	done()
+	if got := rec.get(); len(got) != 0 {
+		t.Errorf("got %v, want no records", got)
+	}
+}
+
+func TestWarnOnDeadlineDone(t *testing.T) {
+	rec := recordDefault(t)
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	done := WarnOnDeadline(ctx, time.Minute)
+	done()
+	done() // a second call is harmless.
+	waitGoroutines(t, before)
+
+	// and when ctx is done first.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	done = WarnOnDeadline(ctx, time.Minute)
+	defer done()
+	cancel()
+	waitGoroutines(t, before)
+	if got := rec.get(); len(got) != 0 {
+		t.Errorf("got %v, want no warnings", got)
+	}
+}
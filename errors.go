@@ -0,0 +1,22 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// LogErr logs msg at ERROR with err attached and returns err wrapped with msg, so that the error is both logged and propagated with context:
+//
+//	if err := db.Ping(ctx); err != nil {
+//		return rplog.LogErr(ctx, "failed to ping database", err)
+//	}
+//
+// If err is nil, LogErr logs nothing and returns nil.
+func LogErr(ctx context.Context, msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	logAt(ctx, 1, slog.LevelError, msg, slog.String("err", err.Error()))
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,48 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// registered events. Empty means "accept any event name".
+var events struct {
+	sync.RWMutex
+	names map[string]bool
+}
+
+// RegisterEvents adds names to the registry of known events.
+// Once any event is registered, Event refuses names that aren't, so that a typo can't silently break downstream subscribers.
+// Call it during program initialization.
+func RegisterEvents(names ...string) {
+	events.Lock()
+	defer events.Unlock()
+	if events.names == nil {
+		events.names = make(map[string]bool, len(names))
+	}
+	for _, name := range names {
+		events.names[name] = true
+	}
+}
+
+func registeredEvent(name string) bool {
+	events.RLock()
+	defer events.RUnlock()
+	return events.names == nil || events.names[name]
+}
+
+// Event emits a machine-consumed business event (e.g, "job_completed", "payment_processed") at INFO,
+// as opposed to a human-readable operational log.
+// Events have a fixed schema: the name in the `event` attribute and the attrs in the `event_data` group,
+// so downstream systems (or a handler routing events to a separate sink) can select them by the presence of `event`.
+//
+// If events have been registered via RegisterEvents and name isn't one of them, an error naming the unregistered event is logged instead.
+func Event(ctx context.Context, name string, attrs ...slog.Attr) {
+	data := slog.Attr{Key: "event_data", Value: slog.GroupValue(attrs...)}
+	if !registeredEvent(name) {
+		logAt(ctx, 1, slog.LevelError, "unregistered event", slog.String("event_name", name), data)
+		return
+	}
+	logAt(ctx, 1, slog.LevelInfo, name, slog.String("event", name), data)
+}
@@ -5,4 +5,5 @@ go 1.21.6
 require (
 	github.com/google/uuid v1.6.0
 	gitlab.com/efronlicht/enve v1.0.2
+	golang.org/x/time v0.5.0
 )
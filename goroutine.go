@@ -0,0 +1,36 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// repanic controls whether Go re-panics after logging a recovered panic, crashing the process as an unrecovered panic would.
+var repanic = env.BoolOr("RUNPOD_LOG_REPANIC", false)
+
+// Go runs fn in a new goroutine. If fn panics, the panic is recovered and logged at ERROR with its stack trace and the Trace from ctx,
+// so that it reaches the log pipeline rather than being lost to the runtime's unstructured crash dump on stderr.
+// It then Flushes (for at most 5 seconds), so the record is delivered even if the panic takes the process down.
+// If RUNPOD_LOG_REPANIC is true, Go re-panics after logging; otherwise, the goroutine exits quietly.
+func Go(ctx context.Context, fn func()) {
+	pc := callerPC(1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				logPC(ctx, pc, slog.LevelError, "panic in goroutine", slog.String("panic", fmt.Sprint(v)), slog.String("stack", string(debug.Stack())))
+				// not ctx, which may well be done: the record should get out either way.
+				flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+				_ = Flush(flushCtx)
+				cancel()
+				if repanic {
+					panic(v)
+				}
+			}
+		}()
+		fn()
+	}()
+}
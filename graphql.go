@@ -0,0 +1,37 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Resolver resolves a single GraphQL field. It has the same underlying type as gqlgen's graphql.Resolver, so one converts directly to the other.
+type Resolver func(ctx context.Context) (res any, err error)
+
+// LogResolver calls next, logging its duration and error (if any) with graphql_operation and graphql_field attributes.
+// The logs carry the Trace from ctx, so every resolver is correlated with the HTTP request that triggered it.
+// Successful resolutions are logged at DEBUG; failures at ERROR.
+//
+// It's meant to be installed as a gqlgen field middleware:
+//
+//	srv.AroundFields(func(ctx context.Context, next graphql.Resolver) (any, error) {
+//		op := graphql.GetOperationContext(ctx).OperationName
+//		field := graphql.GetFieldContext(ctx).Path().String()
+//		return rplog.LogResolver(ctx, op, field, rplog.Resolver(next))
+//	})
+func LogResolver(ctx context.Context, operation, field string, next Resolver) (res any, err error) {
+	start := time.Now()
+	res, err = next(ctx)
+	args := []any{
+		slog.String("graphql_operation", operation),
+		slog.String("graphql_field", field),
+		slog.Int64("elapsed_ms", time.Since(start).Milliseconds()),
+	}
+	if err != nil {
+		logAt(ctx, 1, slog.LevelError, "graphql resolver failed", append(args, slog.String("err", err.Error()))...)
+		return res, err
+	}
+	logAt(ctx, 1, slog.LevelDebug, "graphql resolver completed", args...)
+	return res, nil
+}
@@ -0,0 +1,46 @@
+package rplog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// health is the state of the logging subsystem reported by HealthHandler.
+var health struct {
+	sink           atomic.Value // string: "json", "proto", or "csv", per the Init function called last.
+	proto          atomic.Pointer[protoConn]
+	alerts         atomic.Bool // InitWebhookAlerts was called.
+	alertsInFlight atomic.Int64
+	alertsFailed   atomic.Int64
+}
+
+// HealthHandler returns a handler serving the status of the logging subsystem as JSON, for a `/debug/rplog` endpoint to check during an incident:
+//
+//	level              the current minimum level (see RUNPOD_LOG_LEVEL and WatchLevelFile).
+//	sink               "json", "proto", or "csv", per the Init function called; empty if none was.
+//	proto              for InitProto: the endpoint, whether it's connected, the records queued and those dropped, and when a record was last written.
+//	webhook_alerts     for InitWebhookAlerts: the alerts being sent and those that failed.
+//
+// It's read-only, but reveals the configuration: serve it on an internal admin port.
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := map[string]any{"level": level.Level().String()}
+		if sink, ok := health.sink.Load().(string); ok {
+			status["sink"] = sink
+		}
+		if c := health.proto.Load(); c != nil {
+			p := map[string]any{"endpoint": c.endpoint, "connected": c.connected.Load(), "queued": len(c.queue), "dropped": c.dropped.Load()}
+			if last := c.lastWrite.Load(); last != 0 {
+				p["last_write"] = time.Unix(0, last).UTC()
+			}
+			status["proto"] = p
+		}
+		if health.alerts.Load() {
+			status["webhook_alerts"] = map[string]any{"in_flight": health.alertsInFlight.Load(), "failed": health.alertsFailed.Load()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+	})
+}
@@ -0,0 +1,45 @@
+package rplog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+// ErrDropRecord is returned by a record hook to deliberately drop a record. See SetRecordHook.
+var ErrDropRecord = errors.New("rplog: drop record")
+
+// RecordHook transforms a record in place before it's written. See SetRecordHook.
+type RecordHook func(ctx context.Context, r *slog.Record) error
+
+var recordHook atomic.Pointer[RecordHook]
+
+// SetRecordHook installs hook, which the Handler calls on every record (after adding the Trace) before writing it.
+// Records accumulated by Consolidate are passed to it before they become events, without the Trace: the consolidated record carries that.
+// The hook may mutate the record in place: scrub or add attributes, rewrite the message, and so on.
+// If the hook returns an error, the record is dropped: return ErrDropRecord to do so deliberately, which Handle doesn't report as a failure.
+// The hook must be safe for concurrent use. A nil hook removes the current one.
+func SetRecordHook(hook RecordHook) {
+	if hook == nil {
+		recordHook.Store(nil)
+		return
+	}
+	recordHook.Store(&hook)
+}
+
+// runRecordHook runs the installed hook (if any) on r, reporting whether r should still be written.
+func runRecordHook(ctx context.Context, r *slog.Record) (keep bool, err error) {
+	hook := recordHook.Load()
+	if hook == nil {
+		return true, nil
+	}
+	switch err := (*hook)(ctx, r); {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrDropRecord):
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,53 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// identity is the identity of the caller, as set by WithIdentity.
+type identity string
+
+// WithIdentity returns a child context recording who made the request (e.g, a JWT subject or an mTLS certificate's CN).
+// The Handler attaches it to every log within that context as the `identity` attribute.
+func WithIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey[identity]{}, identity(id))
+}
+
+// IdentityFromCtx returns the identity set by WithIdentity, if it exists.
+func IdentityFromCtx(ctx context.Context) (id string, ok bool) {
+	i, ok := ctx.Value(ctxKey[identity]{}).(identity)
+	return string(i), ok
+}
+
+// IdentityMiddleware returns a middleware that extracts the caller's identity from each request and stores it in the request's context
+// via WithIdentity, so it's logged alongside the Trace. The extractor is supplied by the service, since it depends on the auth mechanism:
+// it should only return identities that have already been validated, and "" if there is none.
+//
+// Example Usage:
+//
+//	mw := rplog.IdentityMiddleware(func(r *http.Request) string {
+//		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+//			return ""
+//		}
+//		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+//	})
+//	http.ListenAndServe(":8080", trace.ServerMiddleware(mw(h)))
+func IdentityMiddleware(extractor func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := extractor(r); id != "" {
+				r = r.WithContext(WithIdentity(r.Context(), id))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// addIdentity adds the identity in ctx (if it exists) to r.
+func addIdentity(ctx context.Context, r *slog.Record) {
+	if id, ok := IdentityFromCtx(ctx); ok {
+		r.AddAttrs(slog.String("identity", id))
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !rplog_nodeps
+
+// Package env looks up the configuration in environment variables. By default, it's a thin layer over gitlab.com/efronlicht/enve;
+// with the rplog_nodeps build tag, it uses only the standard library instead: see env_nodeps.go.
+// Either way, a missing, empty, or invalid variable returns the backup.
+package env
+
+import (
+	"encoding"
+	"strconv"
+	"time"
+
+	"gitlab.com/efronlicht/enve"
+)
+
+// Each function calls enve.Or directly, never through enve's other helpers: enve logs the caller found a fixed number of frames up the stack,
+// which is then the caller of this package rather than this package itself.
+
+func StringOr(key, backup string) string        { return enve.Or(notEmpty, key, backup) }
+func BoolOr(key string, backup bool) bool       { return enve.Or(strconv.ParseBool, key, backup) }
+func IntOr(key string, backup int) int          { return enve.Or(strconv.Atoi, key, backup) }
+func Uint64Or(key string, backup uint64) uint64 { return enve.Or(parseUint64, key, backup) }
+func DurationOr(key string, backup time.Duration) time.Duration {
+	return enve.Or(time.ParseDuration, key, backup)
+}
+
+// Or parses the variable with parse.
+func Or[T any](parse func(string) (T, error), key string, backup T) T {
+	return enve.Or(parse, key, backup)
+}
+
+// FromTextOr parses the variable with T's UnmarshalText method.
+func FromTextOr[T any, PT interface {
+	*T
+	encoding.TextUnmarshaler
+}](key string, backup T) T {
+	return enve.Or(parseText[T, PT], key, backup)
+}
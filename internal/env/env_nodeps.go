@@ -0,0 +1,39 @@
+//go:build rplog_nodeps
+
+package env
+
+import (
+	"encoding"
+	"os"
+	"strconv"
+	"time"
+)
+
+func StringOr(key, backup string) string        { return Or(notEmpty, key, backup) }
+func BoolOr(key string, backup bool) bool       { return Or(strconv.ParseBool, key, backup) }
+func IntOr(key string, backup int) int          { return Or(strconv.Atoi, key, backup) }
+func Uint64Or(key string, backup uint64) uint64 { return Or(parseUint64, key, backup) }
+func DurationOr(key string, backup time.Duration) time.Duration {
+	return Or(time.ParseDuration, key, backup)
+}
+
+// Or parses the variable with parse.
+func Or[T any](parse func(string) (T, error), key string, backup T) T {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return backup
+	}
+	v, err := parse(s)
+	if err != nil {
+		return backup
+	}
+	return v
+}
+
+// FromTextOr parses the variable with T's UnmarshalText method.
+func FromTextOr[T any, PT interface {
+	*T
+	encoding.TextUnmarshaler
+}](key string, backup T) T {
+	return Or(parseText[T, PT], key, backup)
+}
@@ -0,0 +1,15 @@
+package env
+
+import "testing"
+
+// both builds must agree: a variable that's set but empty gets the backup, as with enve.
+func TestStringOrEmpty(t *testing.T) {
+	t.Setenv("RPLOG_TEST_EMPTY", "")
+	if got := StringOr("RPLOG_TEST_EMPTY", "backup"); got != "backup" {
+		t.Errorf("StringOr(empty) = %q, want the backup", got)
+	}
+	t.Setenv("RPLOG_TEST_SET", "set")
+	if got := StringOr("RPLOG_TEST_SET", "backup"); got != "set" {
+		t.Errorf("StringOr(set) = %q, want %q", got, "set")
+	}
+}
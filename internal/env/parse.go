@@ -0,0 +1,26 @@
+package env
+
+import (
+	"encoding"
+	"errors"
+	"strconv"
+)
+
+// notEmpty is the parser of StringOr: as with enve, a variable that's set but empty gets the backup.
+func notEmpty(s string) (string, error) {
+	if s == "" {
+		return "", errors.New("unexpected empty string")
+	}
+	return s, nil
+}
+
+func parseUint64(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }
+
+func parseText[T any, PT interface {
+	*T
+	encoding.TextUnmarshaler
+}](s string) (T, error) {
+	var v T
+	err := PT(&v).UnmarshalText([]byte(s))
+	return v, err
+}
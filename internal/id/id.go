@@ -0,0 +1,26 @@
+// Package id generates UUIDs. By default, it's a thin layer over github.com/google/uuid;
+// with the rplog_nodeps build tag, it uses only the standard library instead: see id_nodeps.go.
+package id
+
+import "encoding/hex"
+
+// UUID is an RFC 9562 UUID.
+type UUID [16]byte
+
+// NameSpaceURL is the namespace for name-based UUIDs of URLs.
+var NameSpaceURL = UUID{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// String returns u in the canonical form, xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
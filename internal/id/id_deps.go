@@ -0,0 +1,19 @@
+//go:build !rplog_nodeps
+
+package id
+
+import "github.com/google/uuid"
+
+// New returns a time-ordered UUIDv7, falling back to a random UUIDv4 if that fails.
+func New() UUID {
+	u, err := uuid.NewV7()
+	if err != nil {
+		u = uuid.New()
+	}
+	return UUID(u)
+}
+
+// NewSHA1 returns the name-based (version 5) UUID of name in space.
+func NewSHA1(space UUID, name []byte) UUID {
+	return UUID(uuid.NewSHA1(uuid.UUID(space), name))
+}
@@ -0,0 +1,31 @@
+//go:build rplog_nodeps
+
+package id
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+)
+
+// New returns a random UUIDv4. Unlike the default build, it isn't time-ordered.
+func New() UUID {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		panic("rplog: crypto/rand failed: " + err.Error())
+	}
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return u
+}
+
+// NewSHA1 returns the name-based (version 5) UUID of name in space.
+func NewSHA1(space UUID, name []byte) UUID {
+	h := sha1.New()
+	h.Write(space[:])
+	h.Write(name)
+	var u UUID
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50 // version 5
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return u
+}
@@ -0,0 +1,74 @@
+package rplog
+
+import (
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// keyCase returns the attribute key conversion selected by RUNPOD_LOG_KEY_CASE: "snake" (the default, which leaves keys alone), "camel", or "pascal".
+// Keys are converted by splitting on underscores: trace_id becomes traceId or TraceId. Keys without underscores are left as-is in camel case,
+// so the builtin keys (time, level, msg, source) are unchanged in camel case and capitalized in pascal case.
+func keyCase() func(string) string {
+	switch c := strings.ToLower(env.StringOr("RUNPOD_LOG_KEY_CASE", "snake")); c {
+	case "camel", "camelcase":
+		return func(k string) string { return joinWords(k, false) }
+	case "pascal", "pascalcase":
+		return func(k string) string { return joinWords(k, true) }
+	case "snake", "snake_case":
+		return nil
+	default:
+		slog.Warn("unknown RUNPOD_LOG_KEY_CASE: falling back to snake_case", slog.String("key_case", c))
+		return nil
+	}
+}
+
+// joinWords joins the underscore-separated words of k, capitalizing every word but the first (or every word, if capitalizeFirst).
+func joinWords(k string, capitalizeFirst bool) string {
+	var b strings.Builder
+	b.Grow(len(k))
+	first := true
+	for _, w := range strings.Split(k, "_") {
+		if w == "" {
+			continue
+		}
+		if first && !capitalizeFirst {
+			b.WriteString(w)
+		} else {
+			r, n := utf8.DecodeRuneInString(w)
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteString(w[n:])
+		}
+		first = false
+	}
+	return b.String()
+}
+
+// convertKeys returns a ReplaceAttr transform converting every (non-group) key via conv. slog never passes group keys to ReplaceAttr:
+// the Handler converts those itself via convertGroupKeys. It returns nil if conv is nil.
+func convertKeys(conv func(string) string) replacer {
+	if conv == nil {
+		return nil
+	}
+	return func(_ []string, a slog.Attr) slog.Attr {
+		a.Key = conv(a.Key)
+		return a
+	}
+}
+
+// convertGroupKeys converts the keys of a and any groups nested within it via conv. Non-group keys are left for ReplaceAttr.
+func convertGroupKeys(conv func(string) string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+	group := a.Value.Group()
+	converted := make([]slog.Attr, len(group))
+	for i, ga := range group {
+		converted[i] = convertGroupKeys(conv, ga)
+	}
+	return slog.Attr{Key: conv(a.Key), Value: slog.GroupValue(converted...)}
+}
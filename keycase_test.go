@@ -0,0 +1,42 @@
+package rplog
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestJoinWords(t *testing.T) {
+	for _, tt := range []struct{ k, camel, pascal string }{
+		{"trace_id", "traceId", "TraceId"},
+		{"msg", "msg", "Msg"},
+		{"http__status_", "httpStatus", "HttpStatus"},
+		{"_leading", "leading", "Leading"},
+		{"élan_vital", "élanVital", "ÉlanVital"},
+		{"", "", ""},
+	} {
+		if got := joinWords(tt.k, false); got != tt.camel {
+			t.Errorf("joinWords(%q, false) = %q, want %q", tt.k, got, tt.camel)
+		}
+		if got := joinWords(tt.k, true); got != tt.pascal {
+			t.Errorf("joinWords(%q, true) = %q, want %q", tt.k, got, tt.pascal)
+		}
+	}
+}
+
+func TestKeyCase(t *testing.T) {
+	t.Setenv("RUNPOD_LOG_KEY_CASE", "camel")
+	var buf bytes.Buffer
+	Init(nil, &buf)
+
+	got := logJSON(t, &buf, func() {
+		slog.Default().With("user_id", 1).WithGroup("http_req").Info("converted", "status_code", 200, slog.Group("tls_info", "cipher_suite", "x"))
+	})
+	if _, ok := got["logId"]; !ok || got["userId"] != 1.0 || got["msg"] != "converted" {
+		t.Errorf("got %v, want logId, userId, and msg at the top level", got)
+	}
+	req, _ := got["httpReq"].(map[string]any)
+	if tls, _ := req["tlsInfo"].(map[string]any); req["statusCode"] != 200.0 || tls["cipherSuite"] != "x" {
+		t.Errorf("got httpReq = %v, want group and nested keys converted", got["httpReq"])
+	}
+}
@@ -0,0 +1,60 @@
+package rplog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// level is the minimum level of the handlers set up by Init (and the other Init functions): initially RUNPOD_LOG_LEVEL.
+var level slog.LevelVar
+
+// levelFilePoll is how often WatchLevelFile re-reads its file.
+const levelFilePoll = 5 * time.Second
+
+// WatchLevelFile sets the minimum level from the file at path (e.g, "DEBUG", or "WARN"; see slog.Level.UnmarshalText),
+// re-reading it every few seconds until ctx is done, so that the level can be changed without a restart by editing a mounted ConfigMap.
+// Invalid contents are logged and ignored, keeping the prior level, as is a missing or unreadable file.
+// A level set on the context via trace.WithLevel still takes precedence.
+func WatchLevelFile(ctx context.Context, path string) {
+	var last []byte
+	read := func() {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if last != nil || !os.IsNotExist(err) {
+				slog.Warn("failed to read log level file", slog.String("path", path), slog.String("err", err.Error()))
+			}
+			last = nil
+			return
+		}
+		b = bytes.TrimSpace(b)
+		if bytes.Equal(b, last) {
+			return
+		}
+		last = b
+		var lvl slog.Level
+		if err := lvl.UnmarshalText(b); err != nil {
+			slog.Warn("ignoring invalid log level file", slog.String("path", path), slog.String("err", err.Error()), slog.String("level", level.Level().String()))
+			return
+		}
+		if lvl != level.Level() {
+			level.Set(lvl)
+			slog.Info("log level changed", slog.String("path", path), slog.String("level", lvl.String()))
+		}
+	}
+	read()
+	go func() {
+		ticker := time.NewTicker(levelFilePoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				read()
+			}
+		}
+	}()
+}
@@ -0,0 +1,50 @@
+package rplog
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchLevelFile(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	t.Cleanup(func() { level.Set(slog.LevelInfo) })
+	path := filepath.Join(t.TempDir(), "level")
+	// each call reads the file once before polling: a done context tests that read alone.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tt := range []struct {
+		contents string // "" removes the file.
+		want     slog.Level
+	}{
+		{"DEBUG", slog.LevelDebug},
+		{" warn\n", slog.LevelWarn},
+		{"bogus", slog.LevelWarn},
+		{"", slog.LevelWarn},
+		{"INFO+2", slog.LevelInfo + 2},
+	} {
+		if tt.contents == "" {
+			os.Remove(path)
+		} else if err := os.WriteFile(path, []byte(tt.contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		WatchLevelFile(ctx, path)
+		if got := level.Level(); got != tt.want {
+			t.Errorf("with %q: level = %v, want %v", tt.contents, got, tt.want)
+		}
+	}
+
+	os.WriteFile(path, []byte("DEBUG"), 0o644)
+	WatchLevelFile(ctx, path)
+	buf.Reset()
+	slog.Debug("kept")
+	if !strings.Contains(buf.String(), `"msg":"kept"`) {
+		t.Errorf("DEBUG record dropped after the level file set DEBUG:\n%s", buf.String())
+	}
+}
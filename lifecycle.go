@@ -0,0 +1,18 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Ready emits the `ready` lifecycle event: call it once the service has finished initializing and is able to serve.
+// Like ShuttingDown, it has the schema of Event, but is never subject to the registry of RegisterEvents.
+func Ready(ctx context.Context) {
+	logAt(ctx, 1, slog.LevelInfo, "ready", slog.String("event", "ready"), slog.Group("event_data"))
+}
+
+// ShuttingDown emits the `shutting_down` lifecycle event, with the reason (e.g, "SIGTERM") in `event_data.reason`:
+// call it as graceful shutdown begins.
+func ShuttingDown(ctx context.Context, reason string) {
+	logAt(ctx, 1, slog.LevelInfo, "shutting_down", slog.String("event", "shutting_down"), slog.Group("event_data", slog.String("reason", reason)))
+}
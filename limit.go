@@ -0,0 +1,107 @@
+package rplog
+
+import "log/slog"
+
+// attrLimit caps the number of attributes on a record, counting those added via slog.Logger.With as well as the record's own,
+// and counting the attributes in a group (recursively) rather than the group itself.
+// It's a safety valve against bugs like calling With in a loop: past the cap, whole attributes are dropped, and `attrs_truncated` records how many.
+// The attributes the Handler adds itself (the Trace, log_id, and so on) aren't counted or dropped.
+type attrLimit struct {
+	max     int // <= 0 means no limit.
+	n       int // attributes accumulated via WithAttrs.
+	dropped int // attributes dropped by WithAttrs.
+}
+
+// apply returns the attrs that fit under the limit, and the limit updated to include them.
+func (l attrLimit) apply(attrs []slog.Attr) ([]slog.Attr, attrLimit) {
+	if l.max <= 0 {
+		return attrs, l
+	}
+	kept := attrs[:0:0]
+	for _, a := range attrs {
+		if n := countAttrs(a); l.n+n <= l.max {
+			kept = append(kept, a)
+			l.n += n
+		} else {
+			l.dropped += n
+		}
+	}
+	return kept, l
+}
+
+// truncate returns r with the attributes that don't fit under the limit dropped, plus `attrs_truncated` if any were dropped here or by WithAttrs.
+func (l attrLimit) truncate(r slog.Record) slog.Record {
+	if l.max <= 0 {
+		return r
+	}
+	n := l.n
+	r.Attrs(func(a slog.Attr) bool {
+		n += countAttrs(a)
+		return true
+	})
+	if n > l.max {
+		var attrs []slog.Attr
+		r.Attrs(func(a slog.Attr) bool {
+			attrs = append(attrs, a)
+			return true
+		})
+		attrs, l = l.apply(attrs)
+		r = slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		r.AddAttrs(attrs...)
+	}
+	if l.dropped > 0 {
+		r.AddAttrs(slog.Int("attrs_truncated", l.dropped))
+	}
+	return r
+}
+
+// countAttrs counts a as one attribute, or, if it's a group, as the attributes in it.
+func countAttrs(a slog.Attr) int {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return 1
+	}
+	n := 0
+	for _, a := range v.Group() {
+		n += countAttrs(a)
+	}
+	return n
+}
+
+// depthExceeded replaces groups nested deeper than RUNPOD_LOG_MAX_DEPTH.
+const depthExceeded = "[nested depth exceeded]"
+
+// limitDepth returns a with any group nested more than max levels deep (a top-level group being one level) replaced by depthExceeded,
+// resolving LogValuers along the way, and whether it replaced any. A max <= 0 means no limit.
+// It guards against runaway recursion in LogValuers, like a recursively-logged struct.
+func limitDepth(a slog.Attr, max int) (slog.Attr, bool) {
+	if max <= 0 {
+		return a, false
+	}
+	return limitDepthAt(a, 1, max)
+}
+
+func limitDepthAt(a slog.Attr, depth, max int) (slog.Attr, bool) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return a, false
+	}
+	if depth > max {
+		return slog.String(a.Key, depthExceeded), true
+	}
+	group := a.Value.Group()
+	var replaced []slog.Attr // copy-on-write: most groups are fine.
+	for i, g := range group {
+		g, changed := limitDepthAt(g, depth+1, max)
+		if changed && replaced == nil {
+			replaced = append(make([]slog.Attr, 0, len(group)), group[:i]...)
+		}
+		if replaced != nil {
+			replaced = append(replaced, g)
+		}
+	}
+	if replaced == nil {
+		return a, false
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(replaced...)}, true
+}
@@ -0,0 +1,69 @@
+package rplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+// logJSON logs via log and returns the record written to buf, decoded.
+func logJSON(t *testing.T, buf *bytes.Buffer, log func()) map[string]any {
+	t.Helper()
+	buf.Reset()
+	log()
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, buf.Bytes())
+	}
+	return got
+}
+
+func TestMaxAttrs(t *testing.T) {
+	t.Setenv("RUNPOD_LOG_MAX_ATTRS", "5")
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	l := slog.Default().With("a", 1, "b", 2, "c", 3)
+
+	// a group counts as the attributes in it, and is dropped whole.
+	got := logJSON(t, &buf, func() { l.Info("over", "d", 4, slog.Group("g", "x", 1, "y", 2, "z", 3)) })
+	if _, ok := got["g"]; ok || got["a"] != 1.0 || got["d"] != 4.0 || got["attrs_truncated"] != 3.0 {
+		t.Errorf("got %v, want g dropped and attrs_truncated: 3", got)
+	}
+	got = logJSON(t, &buf, func() { l.Info("under", "d", 4, "e", 5) })
+	if _, ok := got["attrs_truncated"]; ok || got["e"] != 5.0 {
+		t.Errorf("got %v, want everything and no attrs_truncated", got)
+	}
+
+	// those dropped by With are counted on every record.
+	l = l.With("d", 4, "e", 5, "f", 6)
+	got = logJSON(t, &buf, func() { l.Info("via With", "g", 7) })
+	if _, ok := got["f"]; ok || got["e"] != 5.0 || got["attrs_truncated"] != 2.0 {
+		t.Errorf("got %v, want f and g dropped and attrs_truncated: 2", got)
+	}
+}
+
+// node logs as a group holding its child, so a cycle nests forever.
+type node struct{ next *node }
+
+func (n *node) LogValue() slog.Value { return slog.GroupValue(slog.Any("next", n.next)) }
+
+func TestMaxDepth(t *testing.T) {
+	t.Setenv("RUNPOD_LOG_MAX_DEPTH", "1")
+	var buf bytes.Buffer
+	Init(nil, &buf)
+
+	got := logJSON(t, &buf, func() {
+		slog.Info("nested", slog.Group("a", slog.Group("b", slog.Group("c", "k", 1)), "v", 1))
+	})
+	if a, _ := got["a"].(map[string]any); a["b"] != depthExceeded || a["v"] != 1.0 {
+		t.Errorf("got a = %v, want b replaced by %q and v kept", got["a"], depthExceeded)
+	}
+
+	loop := &node{}
+	loop.next = loop
+	got = logJSON(t, &buf, func() { slog.Info("cycle", "n", loop) })
+	if n, _ := got["n"].(map[string]any); n["next"] != depthExceeded {
+		t.Errorf("got n = %v, want next replaced by %q", got["n"], depthExceeded)
+	}
+}
@@ -2,26 +2,55 @@ package rplog
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"runtime"
 	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/google/uuid"
+	"github.com/runpod/rplog/internal/env"
 	"github.com/runpod/rplog/trace"
-	"gitlab.com/efronlicht/enve"
 )
 
 // slog.Handler implementation that smuggles the Metadata through the slog.Logger.
 // It is used to add the metadata to every log record, and it grabs the Trace from the context if it exists.
 // Generally speaking, you don't need to use this directly.
+//
+// Records share attribute storage with their copies, so a handler must not keep a record past the end of Handle,
+// or pass the same record to more than one handler, without calling slog.Record.Clone first.
+// That goes for any handler in this package that fans records out or processes them asynchronously.
 type Handler struct {
 	slog.Handler
+	keyCase func(string) string  // converts the keys of groups: see RUNPOD_LOG_KEY_CASE. nil leaves them alone.
+	noTrace bool                 // skip adding the Trace: see WithoutTrace.
+	built   time.Time            // the build's commit time, for build_age_hours: see RUNPOD_LOG_BUILD_AGE. zero omits it.
+	meta    *Metadata            // as passed to (or filled in by) Init.
+	opts    *slog.HandlerOptions // as set up by Init, for Sub.
+	attrs   []slog.Attr          // the metadata attributes, for Sub.
+	limit   attrLimit            // caps the attributes per record: see RUNPOD_LOG_MAX_ATTRS.
+	depth   int                  // caps the nesting of groups: see RUNPOD_LOG_MAX_DEPTH. <= 0 means no limit.
+	ceiling time.Duration        // elapsed times past this are flagged as elapsed_suspect: see RUNPOD_LOG_ELAPSED_CEILING. <= 0 means never.
+	seq     bool                 // add a per-process sequence number: see RUNPOD_LOG_SEQ.
+	strict  bool                 // log empty trace IDs on records without a Trace: see RUNPOD_LOG_STRICT_TRACE.
+	groups  []groupOrAttrs       // the groups opened by WithGroup, and the attributes added after them or holding LogValuers, outermost first: see nest.
 }
 
+// groupOrAttrs is a group opened by WithGroup (if name is set), or attributes added by WithAttrs that Handle adds to each record itself.
+type groupOrAttrs struct {
+	name  string
+	attrs []slog.Attr
+}
+
+// seq numbers the records of this process: see RUNPOD_LOG_SEQ.
+var seq atomic.Uint64
+
+// ctxKey is the context key of the value of type T, as in the trace package: each value stored in a context gets a distinct type.
+type ctxKey[T any] struct{}
+
 // Metadata that should be added to every log record.
 // It's generated at 'build' time via the buildmeta package,
 // except for the InstanceID, which is generated exactly once at the beginning of runtime.
@@ -43,6 +72,25 @@ func (m *Metadata) Fields() map[string]any {
 	}
 }
 
+// OTelResource returns the metadata mapped onto OpenTelemetry resource semantic conventions:
+//
+//	Service    -> service.name
+//	VCSTag     -> service.version (or VCSCommit, if there's no tag)
+//	InstanceID -> service.instance.id
+//	Env        -> deployment.environment
+func (m *Metadata) OTelResource() map[string]any {
+	version := m.VCSTag
+	if version == "" {
+		version = m.VCSCommit
+	}
+	return map[string]any{
+		"service.name":           m.Service,
+		"service.version":        version,
+		"service.instance.id":    m.InstanceID,
+		"deployment.environment": m.Env,
+	}
+}
+
 // Initalize the package with one or more writers. This is optional: if you don't call it, the package will initialize itself with a default writer (os.Stderr)
 // it's OK to use nil for the metadata: this program will fill in on a best-effort basis.
 func Init(m *Metadata, writers ...io.Writer) {
@@ -55,6 +103,14 @@ func Init(m *Metadata, writers ...io.Writer) {
 	default:
 		w = io.MultiWriter(writers...)
 	}
+	initHandler(m, func(opts *slog.HandlerOptions) slog.Handler { return newJSONHandler(w, opts) })
+	health.sink.Store("json")
+	health.proto.Store(nil)
+}
+
+// initHandler sets the default logger to a Handler wrapping the handler returned by newBase,
+// which should honor the options it's given, with the metadata attached to every record.
+func initHandler(m *Metadata, newBase func(*slog.HandlerOptions) slog.Handler) {
 	if m == nil {
 		m = &Metadata{}
 		buildinfo, ok := debug.ReadBuildInfo()
@@ -79,15 +135,30 @@ func Init(m *Metadata, writers ...io.Writer) {
 		}
 	}
 FILLED:
-	fmt.Println("rplog.initEager: found metadata", m)
-
-	jsonHandler := slog.NewJSONHandler(w, &slog.HandlerOptions{AddSource: true, Level: enve.FromTextOr("RUNPOD_LOG_LEVEL", slog.LevelInfo)})
+	if m.InstanceID == "" {
+		m2 := *m // don't modify the caller's metadata.
+		m2.InstanceID = trace.NewID()
+		m = &m2
+	}
+	conv := keyCase()
+	level.Set(env.FromTextOr("RUNPOD_LOG_LEVEL", slog.LevelInfo))
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       &level,
+		ReplaceAttr: chain(normalizeTime(), redact, stringifyInts(), convertKeys(conv)),
+	}
+	base := newBase(opts)
 
-	host, err := os.Hostname()
-	if err != nil {
-		host = "unknown"
+	gomaxprocs, numCPU := runtime.GOMAXPROCS(0), runtime.NumCPU()
+	host := env.StringOr("RUNPOD_HOSTNAME", "")
+	if host == "" {
+		// the usual identifier of an instance outside of a container.
+		var err error
+		if host, err = os.Hostname(); err != nil || host == "" {
+			host = "unknown"
+		}
 	}
-	slog.SetDefault(slog.New(&Handler{Handler: jsonHandler.WithAttrs([]slog.Attr{
+	attrs := []slog.Attr{
 		slog.String("vcs_name", m.VCSName),
 		slog.String("vcs_commit", m.VCSCommit),
 		slog.String("vcs_tag", m.VCSTag),
@@ -97,21 +168,365 @@ FILLED:
 		slog.String("instance_id", m.InstanceID),
 		slog.String("service", m.Service),
 		slog.String("language_version", runtime.Version()),
-	})}))
+		slog.Int("gomaxprocs", gomaxprocs),
+		slog.Int("num_cpu", numCPU),
+	}
+	if env.BoolOr("RUNPOD_LOG_OTEL_RESOURCE", false) {
+		// the same metadata under OpenTelemetry's conventional keys, plus the host and runtime. See Metadata.OTelResource.
+		resource := []any{slog.String("host.name", host), slog.String("process.runtime.name", "go"), slog.String("process.runtime.version", runtime.Version())}
+		otel := m.OTelResource()
+		keys := make([]string, 0, len(otel))
+		for k := range otel {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // map order is random: keep the output stable.
+		for _, k := range keys {
+			resource = append(resource, slog.Any(k, otel[k]))
+		}
+		attrs = append(attrs, slog.Group("resource", resource...))
+	}
+	h := &Handler{keyCase: conv, meta: m, opts: opts, attrs: attrs, limit: attrLimit{max: env.IntOr("RUNPOD_LOG_MAX_ATTRS", 1024)}, depth: env.IntOr("RUNPOD_LOG_MAX_DEPTH", 16), ceiling: env.DurationOr("RUNPOD_LOG_ELAPSED_CEILING", 24*time.Hour), seq: env.BoolOr("RUNPOD_LOG_SEQ", false), strict: env.BoolOr("RUNPOD_LOG_STRICT_TRACE", false), Handler: base.WithAttrs(attrs)}
+	if env.BoolOr("RUNPOD_LOG_BUILD_AGE", false) {
+		// unknown or missing outside of a VCS checkout: then there's no age to report.
+		h.built, _ = time.Parse(time.RFC3339, m.VCSTime)
+	}
+	slog.SetDefault(slog.New(h))
+	// one authoritative line recording the build and the start of this instance: the metadata itself is attached by the handler.
+	slog.Info("rplog initialized", slog.Time("service_start", time.Now().UTC()))
+	if gomaxprocs != numCPU {
+		// usually a container CPU limit that the go runtime doesn't know about: expect throttling.
+		slog.Warn("GOMAXPROCS does not match the number of CPUs", slog.Int("gomaxprocs", gomaxprocs), slog.Int("num_cpu", numCPU))
+	}
+}
+
+// Enabled reports whether the handler handles records at the given level.
+// A minimum level set on the context via trace.WithLevel takes precedence over the configured level (RUNPOD_LOG_LEVEL),
+// but only errors are enabled for a trace that was sampled out: see trace.WithSampleRate.
+func (h *Handler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	if keep, ok := trace.SampledFromCtx(ctx); ok && !keep && lvl < slog.LevelError {
+		return false
+	}
+	// the context's level can only let more through, never less: and never so little as to drop an error.
+	if minLvl, ok := trace.LevelFromCtx(ctx); ok && lvl >= min(minLvl, slog.LevelError) {
+		return true
+	}
+	return h.Handler.Enabled(ctx, lvl)
 }
 
-// Handle the log record, adding the metadata to it (always) and the Trace (if it exists).
+// WithAttrs returns a Handler whose attributes consist of both the receiver's attributes and the arguments.
+// It keeps the Handler wrapper so that loggers derived via slog.Logger.With still get the Trace.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	if len(h.groups) > 0 || hasLogValuer(attrs) {
+		// within a group, or with LogValuers that must not be resolved (see Lazy) until a record is written: keep them for nest,
+		// so that the inner handler's attributes stay at the top level. Handle limits and converts them with the record's own.
+		h2.groups = append(h.groups[:len(h.groups):len(h.groups)], groupOrAttrs{attrs: attrs})
+		return &h2
+	}
+	attrs, h2.limit = h.limit.apply(attrs)
+	converted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		a, _ = limitDepth(a, h.depth)
+		if h.keyCase != nil {
+			a = convertGroupKeys(h.keyCase, a)
+		}
+		converted[i] = a
+	}
+	h2.Handler = h.Handler.WithAttrs(converted)
+	return &h2
+}
+
+// WithGroup returns a Handler that starts a group with the given name.
+// It keeps the Handler wrapper so that loggers derived via slog.Logger.WithGroup still get the Trace.
+// The group holds the record's own attributes, and those added after it via WithAttrs: the metadata, Trace, log_id, and the like stay at the top level.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if h.keyCase != nil {
+		name = h.keyCase(name)
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], groupOrAttrs{name: name})
+	return &h2
+}
+
+// nest returns a copy of r with its attributes inside the groups opened by WithGroup, along with the attributes WithAttrs left to Handle,
+// so that the attributes Handle adds afterwards land at the top level rather than in the innermost group.
+func (h *Handler) nest(r slog.Record) slog.Record {
+	if len(h.groups) == 0 {
+		return r
+	}
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		g := h.groups[i]
+		if g.name == "" {
+			attrs = append(g.attrs[:len(g.attrs):len(g.attrs)], attrs...)
+			continue
+		}
+		if len(attrs) == 0 {
+			continue // as slog does, omit empty groups.
+		}
+		attrs = []slog.Attr{{Key: g.name, Value: slog.GroupValue(attrs...)}}
+	}
+	r2 := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r2.AddAttrs(attrs...)
+	return r2
+}
+
+// Handle the log record, adding the metadata and a unique log_id to it (always) and the Trace, operation name, and identity (if they exist).
 func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	// we add attributes below: don't scribble over storage shared with the caller's copy.
+	r = r.Clone()
+	r = renameBadKeys(r)
+	r = h.nest(r)
+	// collapse deep groups before counting: counting resolves LogValuers, and would recurse forever into a cyclic one.
+	r = h.truncateDepth(r)
+	r = h.limit.truncate(r)
+	acc, consolidated := accumulatorFor(ctx, r)
+	if consolidated {
+		// hook and capture the record as it's accumulated: the attributes added below go on the consolidated record instead.
+		if keep, err := runRecordHook(ctx, &r); !keep {
+			return err
+		}
+		captureRecord(ctx, r)
+		if acc.add(r, h.keyCase) {
+			return nil // written as part of the request's consolidated record: see Consolidate.
+		}
+		// the request completed meanwhile: write the record as usual, without hooking or capturing it twice.
+	}
+	// a unique ID per record, so that downstream can deduplicate records delivered more than once.
+	r.AddAttrs(slog.String("log_id", trace.NewID()))
+	if h.seq {
+		// a total order within the process, even among records sharing a timestamp.
+		r.AddAttrs(slog.Uint64("seq", seq.Add(1)))
+	}
+	if !h.built.IsZero() {
+		r.AddAttrs(slog.Int64("build_age_hours", int64(time.Since(h.built).Hours())))
+	}
+	if !h.noTrace {
+		addTrace(ctx, &r, h.ceiling, h.strict)
+	}
+	addIdentity(ctx, &r)
+	if !consolidated {
+		if keep, err := runRecordHook(ctx, &r); !keep {
+			return err
+		}
+		captureRecord(ctx, r)
+	}
+	if h.keyCase != nil {
+		r = rewrite(r, func(a slog.Attr) slog.Attr { return convertGroupKeys(h.keyCase, a) })
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// hasLogValuer reports whether any of attrs, or of the attributes in their groups, is a LogValuer, without resolving it.
+func hasLogValuer(attrs []slog.Attr) bool {
+	for _, a := range attrs {
+		switch a.Value.Kind() {
+		case slog.KindLogValuer:
+			return true
+		case slog.KindGroup:
+			if hasLogValuer(a.Value.Group()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// truncateDepth returns r with groups nested deeper than the handler allows collapsed: see limitDepth.
+func (h *Handler) truncateDepth(r slog.Record) slog.Record {
+	deep := false
+	r.Attrs(func(a slog.Attr) bool {
+		_, deep = limitDepth(a, h.depth)
+		return !deep
+	})
+	if !deep {
+		return r
+	}
+	return rewrite(r, func(a slog.Attr) slog.Attr {
+		a, _ = limitDepth(a, h.depth)
+		return a
+	})
+}
+
+// badKey is the key slog gives a value passed without one, as in slog.Info("msg", "key", value, oops): see slog.Logger.Log.
+const badKey = "!BADKEY"
+
+// renameBadKeys returns r with its values that were passed without a key renamed positionally, to arg0, arg1, and so on, rather than the cryptic !BADKEY.
+func renameBadKeys(r slog.Record) slog.Record {
+	bad := false
+	r.Attrs(func(a slog.Attr) bool {
+		bad = a.Key == badKey
+		return !bad
+	})
+	if !bad {
+		return r
+	}
+	n := 0
+	return rewrite(r, func(a slog.Attr) slog.Attr {
+		if a.Key != badKey {
+			return a
+		}
+		a.Key = "arg" + strconv.Itoa(n)
+		n++
+		return a
+	})
+}
+
+// addTrace adds the attributes of the Trace, operation name, external IDs, request attempt, connection ID, span, job name, and HTTP request info in ctx (if they exist) to r.
+// An elapsed time past the ceiling (if positive) is almost certainly a stale start time or clock skew rather than a slow request: it's flagged with elapsed_suspect.
+// If strict, a record without a Trace gets empty trace_id and request_id rather than none.
+func addTrace(ctx context.Context, r *slog.Record, ceiling time.Duration, strict bool) {
 	if t, ok := trace.FromCtx(ctx); ok {
 		now := time.Now()
-		traceElapsedMs := now.Sub(t.TraceStart).Milliseconds()
-		requestElapsedMs := now.Sub(t.RequestStart).Milliseconds()
-		r.AddAttrs(
-			slog.String("trace_id", t.TraceID),
-			slog.String("request_id", t.RequestID),
-			slog.Int64("trace_elapsed_ms", traceElapsedMs),
-			slog.Int64("request_elapsed_ms", requestElapsedMs),
-		)
+		r.AddAttrs(slog.String("trace_id", t.TraceID), slog.String("request_id", t.RequestID))
+		// a Trace built by hand or decoded from a queue message may lack its start times: omit the elapsed time rather than log ~2000 years.
+		suspect := false
+		if !t.TraceStart.IsZero() {
+			elapsed := now.Sub(t.TraceStart)
+			suspect = ceiling > 0 && elapsed > ceiling
+			r.AddAttrs(slog.Int64("trace_elapsed_ms", elapsed.Milliseconds()))
+		}
+		if !t.RequestStart.IsZero() {
+			elapsed := now.Sub(t.RequestStart)
+			suspect = suspect || ceiling > 0 && elapsed > ceiling
+			r.AddAttrs(slog.Int64("request_elapsed_ms", elapsed.Milliseconds()))
+		}
+		if suspect {
+			r.AddAttrs(slog.Bool("elapsed_suspect", true))
+		}
+		if !t.ProcessingStart.IsZero() && !t.RequestStart.IsZero() {
+			r.AddAttrs(
+				slog.Int64("request_queue_ms", t.ProcessingStart.Sub(t.RequestStart).Milliseconds()),
+				slog.Int64("request_processing_ms", now.Sub(t.ProcessingStart).Milliseconds()),
+			)
+		}
+		if t.PrevTraceID != "" {
+			r.AddAttrs(slog.String("prev_trace_id", t.PrevTraceID))
+		}
+		if t.Variant != "" {
+			r.AddAttrs(slog.String("trace_variant", t.Variant))
+		}
+	} else if strict {
+		// a uniform schema for consumers that insist on one: every record has the trace IDs, empty if there's no Trace.
+		r.AddAttrs(slog.String("trace_id", ""), slog.String("request_id", ""))
 	}
-	return h.Handler.Handle(ctx, r)
+	if op, ok := trace.OperationFromCtx(ctx); ok {
+		r.AddAttrs(slog.String("operation", op))
+	}
+	if ids, ok := trace.ExternalIDsFromCtx(ctx); ok {
+		keys := make([]string, 0, len(ids))
+		for k := range ids {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]any, len(keys))
+		for i, k := range keys {
+			attrs[i] = slog.String(k, ids[k])
+		}
+		r.AddAttrs(slog.Group("external_ids", attrs...))
+	}
+	if n, ok := trace.AttemptFromCtx(ctx); ok {
+		r.AddAttrs(slog.Int("request_attempt", n))
+	}
+	if id, ok := trace.ConnIDFromCtx(ctx); ok {
+		r.AddAttrs(slog.String("conn_id", id))
+	}
+	if span, ok := trace.SpanFromCtx(ctx); ok {
+		r.AddAttrs(slog.String("span_id", span.ID))
+		if span.ParentID != "" {
+			r.AddAttrs(slog.String("parent_span_id", span.ParentID))
+		}
+		r.AddAttrs(slog.String("span_name", span.Name))
+	}
+	if name, ok := trace.JobFromCtx(ctx); ok {
+		r.AddAttrs(slog.String("job", name))
+	}
+	if info, ok := trace.RequestInfoFromCtx(ctx); ok {
+		attrs := []any{slog.String("method", info.Method), slog.String("path", info.Path)}
+		if info.Route != "" {
+			attrs = append(attrs, slog.String("route", info.Route))
+		}
+		r.AddAttrs(slog.Group("http", attrs...))
+	}
+}
+
+// WithoutTrace returns a logger like slog.Default() whose records never carry the Trace or operation name, even if the context has them.
+// Use it for infrastructure-level logs that run outside any request, where trace attributes would be misleading.
+func WithoutTrace() *slog.Logger {
+	h, ok := slog.Default().Handler().(*Handler)
+	if !ok {
+		return slog.Default()
+	}
+	h2 := *h
+	h2.noTrace = true
+	return slog.New(&h2)
+}
+
+// Named returns a logger like slog.Default() for the named subsystem (e.g, "db"), whose records carry the name in the `logger` attribute.
+// Prefer it to ad-hoc With("component", ...) calls, so that every subsystem's logs can be queried the same way.
+func Named(name string) *slog.Logger {
+	return slog.Default().With(slog.String("logger", name))
+}
+
+// Sub returns a logger like slog.Default() for one of several logically separate components sharing this process (and so its log stream),
+// whose records carry the component's name in the `stream` attribute so that the stream can be demultiplexed.
+// If w is not nil, the logger's records are written to w instead, as JSON with the metadata, like Init's:
+// for physically separate streams. Unlike Named, which only labels a subsystem's records, Sub is meant for separating streams.
+// The substream keeps the webhook alerts of InitWebhookAlerts. w is ignored unless slog's default handler is the one set up by Init:
+// once wrapped (e.g, by NewSummarizingHandler), the records are written to the default stream.
+func Sub(stream string, w io.Writer) *slog.Logger {
+	l := slog.Default()
+	if h, ok := l.Handler().(*Handler); ok && w != nil && h.opts != nil {
+		h2 := *h
+		h2.Handler = newJSONHandler(w, h.opts).WithAttrs(h.attrs)
+		if r, ok := h.Handler.(rebaser); ok {
+			h2.Handler = r.rebase(h2.Handler)
+		}
+		h2.groups = nil
+		l = slog.New(&h2)
+	}
+	return l.With(slog.String("stream", stream))
+}
+
+// rebaser is a handler wrapping the Handler's inner handler, such as InitWebhookAlerts', which Sub re-applies around the inner handler of a substream.
+type rebaser interface {
+	rebase(next slog.Handler) slog.Handler
+}
+
+// rewrite returns a copy of r with each of its attributes replaced by f(attr).
+func rewrite(r slog.Record, f func(slog.Attr) slog.Attr) slog.Record {
+	r2 := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		r2.AddAttrs(f(a))
+		return true
+	})
+	return r2
+}
+
+// logAt logs msg at the given level via the default logger, attributing the record's source to the function skip frames above logAt's caller.
+// Helpers in this package use it so that the source points at the application's call site rather than at the helper itself.
+func logAt(ctx context.Context, skip int, lvl slog.Level, msg string, args ...any) {
+	logPC(ctx, callerPC(skip+1), lvl, msg, args...)
+}
+
+// callerPC returns the program counter of the function skip frames above callerPC's caller.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:]) // skip runtime.Callers and callerPC
+	return pcs[0]
+}
+
+// logPC logs msg at the given level via the default logger, attributing the record's source to pc.
+func logPC(ctx context.Context, pc uintptr, lvl slog.Level, msg string, args ...any) {
+	l := slog.Default()
+	if !l.Enabled(ctx, lvl) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), lvl, msg, pc)
+	r.Add(args...)
+	_ = l.Handler().Handle(ctx, r)
 }
@@ -1,12 +1,475 @@
 package rplog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/runpod/rplog/trace"
 )
 
 func TestLog(t *testing.T) {
 	Init(nil, os.Stderr)
 	slog.Error("hi")
 }
+
+func TestEnabledContextLevel(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	ctx := trace.CtxWith(context.Background(), trace.New())
+
+	slog.DebugContext(ctx, "dropped")
+	slog.DebugContext(trace.WithLevel(ctx, slog.LevelDebug), "kept")
+	// loggers derived via With must keep honoring the context's level.
+	slog.Default().With("k", "v").DebugContext(trace.WithLevel(ctx, slog.LevelDebug), "kept via With")
+	// the context's level only lowers the threshold: it can't hide records the configured level allows, or errors.
+	slog.InfoContext(trace.WithLevel(ctx, slog.LevelError), "not raised")
+	slog.ErrorContext(trace.WithLevel(ctx, slog.LevelError+100), "error kept")
+
+	out := buf.String()
+	for _, msg := range []string{`"msg":"kept"`, `"msg":"kept via With"`, `"msg":"not raised"`, `"msg":"error kept"`} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("missing %s in output:\n%s", msg, out)
+		}
+	}
+	for _, msg := range []string{`"msg":"dropped"`} {
+		if strings.Contains(out, msg) {
+			t.Errorf("unexpected %s in output:\n%s", msg, out)
+		}
+	}
+}
+
+// X-Trace-Level comes from the client: it must only count from trusted networks, and never suppress errors even then.
+func TestHostileTraceLevel(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	h := func(trusted bool) http.Handler {
+		var opts []trace.Option
+		if trusted {
+			opts = append(opts, trace.WithTrustedNetworks(netip.MustParsePrefix("192.0.2.0/24"))) // httptest's RemoteAddr.
+		}
+		return trace.ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slog.DebugContext(r.Context(), "debug")
+			slog.ErrorContext(r.Context(), "error")
+		}), opts...)
+	}
+	for _, tt := range []struct {
+		name, level        string
+		trusted            bool
+		wantDebug, wantErr bool
+	}{
+		{"untrusted debug", "DEBUG", false, false, true},
+		{"untrusted silence", "ERROR+100", false, false, true},
+		{"trusted debug", "DEBUG", true, true, true},
+		{"trusted silence", "ERROR+100", true, false, true},
+	} {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Trace-Level", tt.level)
+		h(tt.trusted).ServeHTTP(httptest.NewRecorder(), r)
+		out := buf.String()
+		if got := strings.Contains(out, `"msg":"debug"`); got != tt.wantDebug {
+			t.Errorf("%s: debug logged = %v, want %v", tt.name, got, tt.wantDebug)
+		}
+		if got := strings.Contains(out, `"msg":"error"`); got != tt.wantErr {
+			t.Errorf("%s: error logged = %v, want %v", tt.name, got, tt.wantErr)
+		}
+	}
+}
+
+func TestHelperSource(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	buf.Reset()
+	_ = LogErr(context.Background(), "failed", errors.New("boom"))
+
+	var rec struct {
+		Source struct{ Function, File string } `json:"source"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	if !strings.HasSuffix(rec.Source.File, "log_test.go") || !strings.HasSuffix(rec.Source.Function, "TestHelperSource") {
+		t.Errorf("source = %+v, want the call site in TestHelperSource", rec.Source)
+	}
+}
+
+// a fan-out that (wrongly) hands the same record to several handlers at once mustn't see the attributes the Handler adds.
+// run with -race.
+func TestHandleSharedRecord(t *testing.T) {
+	Init(nil, io.Discard)
+	h := slog.Default().Handler().(*Handler)
+	// so the Handler has plenty to add: log_id, trace_id, request_id, and operation.
+	ctx := trace.WithOperation(trace.CtxWith(context.Background(), trace.Trace{TraceID: "t", RequestID: "r"}), "op")
+
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "shared", 0)
+	for i := 0; i < 8; i++ {
+		r.AddAttrs(slog.Int(fmt.Sprintf("k%d", i), i))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = h.Handle(ctx, r)
+		}()
+	}
+	wg.Wait()
+	r.AddAttrs(slog.String("after", "handle"))
+	var attrs []string
+	r.Attrs(func(a slog.Attr) bool { attrs = append(attrs, a.Key); return true })
+	if want := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7", "after"}; !slices.Equal(attrs, want) {
+		t.Errorf("record storage was shared with the Handler: attrs %v, want %v", attrs, want)
+	}
+}
+
+func TestZeroStartOmitsElapsed(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	buf.Reset()
+	slog.InfoContext(trace.CtxWith(context.Background(), trace.Trace{TraceID: "t", RequestID: "r"}), "manual")
+	if out := buf.String(); strings.Contains(out, "elapsed_ms") || !strings.Contains(out, `"trace_id":"t"`) {
+		t.Errorf("want the trace without elapsed times, got:\n%s", out)
+	}
+}
+
+// golden-file tests and readers rely on the order of RUNPOD_LOG_KEY_ORDER=stable: time, level, msg, then values, then groups.
+func TestKeyOrder(t *testing.T) {
+	for _, keyCase := range []string{"snake", "pascal"} {
+		t.Setenv("RUNPOD_LOG_KEY_ORDER", "stable")
+		t.Setenv("RUNPOD_LOG_KEY_CASE", keyCase)
+		var buf bytes.Buffer
+		Init(nil, &buf)
+		buf.Reset()
+		slog.Info("ordered", slog.Group("g", "a", 1), "k", "v")
+
+		dec := json.NewDecoder(&buf)
+		var keys []string
+		if _, err := dec.Token(); err != nil { // {
+			t.Fatal(err)
+		}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, strings.ToLower(tok.(string)))
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if want := []string{"time", "level", "msg"}; len(keys) < len(want) || !slices.Equal(keys[:len(want)], want) {
+			t.Errorf("%s: keys = %v, want them to start with %v", keyCase, keys, want)
+		}
+		if tail := keys[len(keys)-2:]; !slices.Equal(tail, []string{"source", "g"}) {
+			t.Errorf("%s: keys = %v, want them to end with the groups, source and g", keyCase, keys)
+		}
+		if !slices.Contains(keys, "k") || !slices.Contains(keys, "log_id") && !slices.Contains(keys, "logid") {
+			t.Errorf("%s: keys = %v, missing some", keyCase, keys)
+		}
+	}
+}
+
+func TestRenameBadKeys(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	buf.Reset()
+	args := []any{"k", "v", 42} // via a slice, which vet can't check.
+	slog.Info("forgot a key", args...)
+	if out := buf.String(); !strings.Contains(out, `"arg0":42`) || strings.Contains(out, badKey) {
+		t.Errorf("want the dangling value as arg0, got:\n%s", out)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	Init(nil, io.Discard)
+	records := Capture(context.Background(), func(ctx context.Context) {
+		slog.InfoContext(ctx, "captured", "k", "v")
+		slog.DebugContext(ctx, "below the level")
+	})
+	slog.Info("not captured")
+	if len(records) != 1 || records[0].Message != "captured" {
+		t.Fatalf("got %+v, want just the record logged in fn", records)
+	}
+	if v, ok := records[0].Attr("k"); !ok || v.String() != "v" {
+		t.Errorf("k = %v, want v", v)
+	}
+	if _, ok := records[0].Attr("log_id"); !ok {
+		t.Errorf("missing log_id in %+v", records[0].Attrs)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	calls := 0
+	lazy := func() slog.Attr { return Lazy("expensive", func() any { calls++; return 42 }) }
+
+	slog.Debug("below the level", lazy())
+	var sampledOut context.Context
+	trace.ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { sampledOut = r.Context() }), trace.WithSampleRate(1e-12)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	slog.InfoContext(sampledOut, "sampled out", lazy())
+	if calls != 0 {
+		t.Fatalf("fn called %d times for dropped records", calls)
+	}
+	slog.Info("written", lazy())
+	if calls != 1 || !strings.Contains(buf.String(), `"expensive":42`) {
+		t.Errorf("fn called %d times, want 1; output:\n%s", calls, buf.String())
+	}
+
+	// nor by With, which would otherwise resolve it before any record is written.
+	calls = 0
+	buf.Reset()
+	l := slog.Default().With(lazy(), slog.Group("g", lazy())).With("after", 1)
+	l.Debug("below the level")
+	if calls != 0 {
+		t.Fatalf("fn called %d times by With", calls)
+	}
+	l.Info("written via With")
+	if out := buf.String(); calls != 2 || !strings.Contains(out, `"expensive":42,"g":{"expensive":42},"after":1`) {
+		t.Errorf("fn called %d times, want 2; output:\n%s", calls, out)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	ctx := trace.CtxWith(context.Background(), trace.New())
+	outerCtx, outer := trace.StartSpan(ctx, "outer")
+	innerCtx, inner := trace.StartSpan(outerCtx, "inner")
+	buf.Reset()
+	slog.InfoContext(innerCtx, "in inner")
+
+	var got struct {
+		TraceID      string `json:"trace_id"`
+		SpanID       string `json:"span_id"`
+		ParentSpanID string `json:"parent_span_id"`
+		SpanName     string `json:"span_name"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	tr, _ := trace.FromCtx(ctx)
+	if got.TraceID != tr.TraceID || got.SpanID != inner.ID || got.ParentSpanID != outer.ID || got.SpanName != "inner" {
+		t.Errorf("got %+v, want the inner span %+v of outer %q in trace %q", got, inner, outer.ID, tr.TraceID)
+	}
+}
+
+func TestTmpl(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	buf.Reset()
+	Tmpl(context.Background(), slog.LevelInfo, "user {user} logged in from {ip} {unknown}", "user", "alice", slog.String("ip", "1.2.3.4"))
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["msg"] != "user alice logged in from 1.2.3.4 {unknown}" || got["user"] != "alice" || got["ip"] != "1.2.3.4" {
+		t.Errorf("got msg %q, user %q, ip %q", got["msg"], got["user"], got["ip"])
+	}
+	if got["msg_template"] != "user {user} logged in from {ip} {unknown}" {
+		t.Errorf("got msg_template %q", got["msg_template"])
+	}
+}
+
+// the attributes the Handler adds must stay at the top level, not land in the logger's group, or queries on trace_id miss them.
+func TestWithGroupKeepsHandlerAttrsTopLevel(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	buf.Reset()
+	ctx := trace.CtxWith(context.Background(), trace.Trace{TraceID: "t", RequestID: "r"})
+	slog.Default().With("outer", 1).WithGroup("g").With("inner", 2).WithGroup("h").InfoContext(ctx, "grouped", "k", 3)
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"trace_id", "log_id", "service", "outer"} {
+		if _, ok := got[k]; !ok {
+			t.Errorf("missing top-level %q in %s", k, buf.Bytes())
+		}
+	}
+	g, _ := got["g"].(map[string]any)
+	if h, _ := g["h"].(map[string]any); g["inner"] != 2.0 || h["k"] != 3.0 || len(g) != 2 || len(h) != 1 {
+		t.Errorf("got group g = %v, want {inner: 2, h: {k: 3}}", got["g"])
+	}
+}
+
+func TestRedactCardNumbers(t *testing.T) {
+	SetRedactPatterns(DefaultRedactPatterns)
+	defer SetRedactPatterns(nil)
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"card 4111 1111 1111 1111 on file", "card [REDACTED] on file"},
+		{"card 4111-1111-1111-1111", "card [REDACTED]"},
+		{"card 5500005555555559", "card [REDACTED]"},
+		{"card 4111 1111 1111 1112 fails luhn", "card 4111 1111 1111 1112 fails luhn"},
+		{"order 1234567890123", "order 1234567890123"},
+		{"at 1718000000000000000", "at 1718000000000000000"},
+	} {
+		if got := redact(nil, slog.String("k", tt.in)).Value.String(); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	t.Setenv("RUNPOD_LOG_KEY_CASE", "camel")
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	serve := func(h http.HandlerFunc) map[string]any {
+		buf.Reset()
+		trace.ServerMiddleware(Consolidate(h)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		var got map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("want one record: %v\n%s", err, buf.Bytes())
+		}
+		return got
+	}
+
+	got := serve(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "step", "user_id", 1, slog.Group("db_call", "row_count", 2))
+	})
+	events, _ := got["events"].([]any)
+	if len(events) != 1 {
+		t.Fatalf("events = %v, want one", got["events"])
+	}
+	event := events[0].(map[string]any)
+	if dbCall, _ := event["dbCall"].(map[string]any); event["msg"] != "step" || event["userId"] != 1.0 || dbCall["rowCount"] != 2.0 {
+		t.Errorf("event = %v, want camelCase keys like the record's", event)
+	}
+
+	got = serve(func(w http.ResponseWriter, r *http.Request) {})
+	if events, ok := got["events"].([]any); !ok || len(events) != 0 {
+		t.Errorf("events = %#v, want []", got["events"])
+	}
+}
+
+// the downstream calls are summarized once per request, at INFO: by Consolidate if it's used, or else by trace.ServerMiddleware.
+func TestDownstreamCallsLoggedOnce(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	client := trace.NewClient(nil)
+	call := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", backend.URL, nil)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	})
+	for name, h := range map[string]http.Handler{
+		"ServerMiddleware":             trace.ServerMiddleware(call),
+		"ServerMiddleware+Consolidate": trace.ServerMiddleware(Consolidate(call)),
+	} {
+		buf.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 {
+			t.Errorf("%s: got %d records, want one:\n%s", name, len(lines), buf.String())
+			continue
+		}
+		var got map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if calls, _ := got["downstream_calls"].([]any); got["msg"] != "request completed" || got["level"] != "INFO" || len(calls) != 1 {
+			t.Errorf("%s: got %v, want an INFO summary of one call", name, got)
+		}
+	}
+}
+
+// records folded into a consolidated record's events still go through the record hook and Capture.
+func TestConsolidateHookAndCapture(t *testing.T) {
+	var buf bytes.Buffer
+	Init(nil, &buf)
+	SetRecordHook(func(ctx context.Context, r *slog.Record) error {
+		if r.Message == "drop" {
+			return ErrDropRecord
+		}
+		r.AddAttrs(slog.Bool("hooked", true))
+		return nil
+	})
+	t.Cleanup(func() { SetRecordHook(nil) })
+	buf.Reset()
+
+	var captured []LogRecord
+	trace.ServerMiddleware(Consolidate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = Capture(r.Context(), func(ctx context.Context) {
+			slog.InfoContext(ctx, "kept")
+			slog.InfoContext(ctx, "drop")
+		})
+	}))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("want one record: %v\n%s", err, buf.Bytes())
+	}
+	events, _ := got["events"].([]any)
+	if len(events) != 1 || events[0].(map[string]any)["msg"] != "kept" || events[0].(map[string]any)["hooked"] != true {
+		t.Errorf("events = %v, want only the hooked record", got["events"])
+	}
+	if len(captured) != 1 || captured[0].Message != "kept" {
+		t.Errorf("captured %v, want the kept record", captured)
+	}
+}
+
+func TestSub(t *testing.T) {
+	var alerts []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]any
+		json.NewDecoder(r.Body).Decode(&alert)
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, fmt.Sprint(alert["msg"]))
+	}))
+	defer srv.Close()
+	var main, sub bytes.Buffer
+	Init(&Metadata{Service: "svc"}, &main)
+	InitWebhookAlerts(srv.URL, slog.LevelError, time.Hour)
+	main.Reset()
+
+	// a shared writer: the records are labeled, and written to the default stream.
+	got := logJSON(t, &main, func() { Sub("audit", nil).Info("shared") })
+	if got["stream"] != "audit" || got["msg"] != "shared" || got["service"] != "svc" {
+		t.Errorf("got %v, want the labeled record in the default stream", got)
+	}
+
+	// a distinct writer: the records are written there instead, with the metadata, and still alert.
+	main.Reset()
+	got = logJSON(t, &sub, func() { Sub("audit", &sub).Error("separate") })
+	if got["stream"] != "audit" || got["msg"] != "separate" || got["service"] != "svc" {
+		t.Errorf("got %v, want the labeled record with the metadata in the substream", got)
+	}
+	if main.Len() != 0 {
+		t.Errorf("substream record also written to the default stream:\n%s", main.String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(alerts, []string{"separate"}) {
+		t.Errorf("alerts = %v, want one for the substream's error", alerts)
+	}
+}
@@ -0,0 +1,31 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Metric emits a gauge for a log-to-metrics pipeline (e.g, Datadog or Vector) to extract, at INFO.
+// Like Event, it has a fixed schema: the name in `metric_name`, the value in `metric_value`, "gauge" in `metric_type`,
+// and the tags in the `metric_tags` group, so that a pipeline (or a handler routing metrics to a separate sink) can select them by the presence of `metric_name`.
+//
+//	rplog.Metric(ctx, "queue_depth", float64(len(queue)), slog.String("queue", "jobs"))
+func Metric(ctx context.Context, name string, value float64, tags ...slog.Attr) {
+	logAt(ctx, 1, slog.LevelInfo, name, metricAttrs(name, value, "gauge", tags)...)
+}
+
+// Count is like Metric, but emits a counter: n is the amount to add to the count, rather than its current value.
+//
+//	rplog.Count(ctx, "jobs_failed", 1, slog.String("reason", "timeout"))
+func Count(ctx context.Context, name string, n int64, tags ...slog.Attr) {
+	logAt(ctx, 1, slog.LevelInfo, name, metricAttrs(name, float64(n), "count", tags)...)
+}
+
+func metricAttrs(name string, value float64, typ string, tags []slog.Attr) []any {
+	return []any{
+		slog.String("metric_name", name),
+		slog.Float64("metric_value", value),
+		slog.String("metric_type", typ),
+		slog.Attr{Key: "metric_tags", Value: slog.GroupValue(tags...)},
+	}
+}
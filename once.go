@@ -0,0 +1,20 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// onceKeys are the keys Once has logged.
+var onceKeys sync.Map
+
+// Once logs msg at the given level the first time it's called with key in this process, and never again,
+// for conditions that recur but only need reporting once: deprecation notices, one-time config warnings, and so on.
+// The args are handled as in slog.Logger.Log. Unlike SampledByKey, keys are never forgotten: use a fixed set of them.
+func Once(ctx context.Context, key string, lvl slog.Level, msg string, args ...any) {
+	if _, seen := onceKeys.LoadOrStore(key, struct{}{}); seen {
+		return
+	}
+	logAt(ctx, 1, lvl, msg, args...)
+}
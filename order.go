@@ -0,0 +1,100 @@
+package rplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// newJSONHandler returns the JSON handler of Init and Sub, writing to w: via an orderedWriter, if RUNPOD_LOG_KEY_ORDER is "stable".
+func newJSONHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	if strings.ToLower(env.StringOr("RUNPOD_LOG_KEY_ORDER", "slog")) == "stable" {
+		w = orderedWriter{w}
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// orderedWriter rewrites each JSON record written to it into a deterministic top-level key order before passing it on:
+// time, level, and msg first (whatever their case: see RUNPOD_LOG_KEY_CASE), then the other values, then the groups (and source), each in the order written.
+// It doesn't rely on the order in which slog happens to write keys, so golden-file tests and human readers get the same layout across versions,
+// at the cost of re-parsing every record. A write that isn't a single JSON object is passed on as it is.
+type orderedWriter struct{ w io.Writer }
+
+// orderedKeys are the keys orderedWriter puts first, in order.
+var orderedKeys = [...]string{slog.TimeKey, slog.LevelKey, slog.MessageKey}
+
+func (o orderedWriter) Write(p []byte) (int, error) {
+	type field struct {
+		key []byte // as written, quoted and escaped.
+		val json.RawMessage
+	}
+	var first [len(orderedKeys)]*field
+	var values, groups []field
+	dec := json.NewDecoder(bytes.NewReader(p))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return o.w.Write(p)
+	}
+	for dec.More() {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return o.w.Write(p)
+		}
+		key := bytes.TrimLeft(p[start:dec.InputOffset()], " ,")
+		f := field{key: key}
+		if err := dec.Decode(&f.val); err != nil {
+			return o.w.Write(p)
+		}
+		if i := orderedIndex(tok.(string)); i >= 0 && first[i] == nil {
+			first[i] = &f
+		} else if len(f.val) > 0 && f.val[0] == '{' {
+			groups = append(groups, f)
+		} else {
+			values = append(values, f)
+		}
+	}
+	if _, err := dec.Token(); err != nil || dec.More() {
+		return o.w.Write(p)
+	}
+
+	b := make([]byte, 0, len(p))
+	b = append(b, '{')
+	add := func(f field) {
+		if len(b) > 1 {
+			b = append(b, ',')
+		}
+		b = append(append(append(b, f.key...), ':'), f.val...)
+	}
+	for _, f := range first {
+		if f != nil {
+			add(*f)
+		}
+	}
+	for _, f := range values {
+		add(f)
+	}
+	for _, f := range groups {
+		add(f)
+	}
+	b = append(b, '}')
+	if bytes.HasSuffix(p, []byte("\n")) {
+		b = append(b, '\n')
+	}
+	if _, err := o.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func orderedIndex(key string) int {
+	for i, k := range orderedKeys {
+		if strings.EqualFold(key, k) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,123 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SizeProfiler wraps a slog.Handler, measuring the serialized size of every record by message
+// and logging the top N messages by total bytes every interval: e.g, "the `request completed` log is 40% of our volume".
+// It's a cost-attribution tool, off unless you install it:
+//
+//	slog.SetDefault(slog.New(rplog.NewSizeProfiler(ctx, slog.Default().Handler(), time.Hour, 10)))
+//
+// Measuring means encoding every record a second time, under a lock: don't leave it on in latency-sensitive services.
+// Sizes don't include the attributes added by Init (which are the same on every record) or by slog.Logger.With.
+type SizeProfiler struct {
+	slog.Handler
+	p *sizeProfile // shared among handlers derived via WithAttrs and WithGroup
+}
+
+type sizeProfile struct {
+	mu      sync.Mutex
+	w       countingWriter
+	measure slog.Handler // encodes records into w.
+	stats   map[string]*SizeStat
+	next    slog.Handler // the handler passed to NewSizeProfiler, which receives the summaries.
+}
+
+// SizeStat is the serialized size of all records with a given message, as logged by a SizeProfiler.
+type SizeStat struct {
+	Msg   string  `json:"msg"`
+	Count int     `json:"count"`
+	Bytes int     `json:"bytes"`
+	Share float64 `json:"share"` // of all bytes logged in the interval.
+}
+
+type countingWriter struct{ n int }
+
+func (w *countingWriter) Write(p []byte) (int, error) { w.n += len(p); return len(p), nil }
+
+// NewSizeProfiler returns a SizeProfiler wrapping next, which logs the topN messages by size every interval until ctx is done.
+func NewSizeProfiler(ctx context.Context, next slog.Handler, interval time.Duration, topN int) *SizeProfiler {
+	p := &sizeProfile{stats: make(map[string]*SizeStat), next: next}
+	p.measure = slog.NewJSONHandler(&p.w, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.report(interval, topN)
+			}
+		}
+	}()
+	return &SizeProfiler{Handler: next, p: p}
+}
+
+// Handle measures r, then passes it on to the wrapped handler.
+func (h *SizeProfiler) Handle(ctx context.Context, r slog.Record) error {
+	h.p.mu.Lock()
+	h.p.w.n = 0
+	_ = h.p.measure.Handle(ctx, r)
+	s, ok := h.p.stats[r.Message]
+	if !ok {
+		s = &SizeStat{Msg: r.Message}
+		h.p.stats[r.Message] = s
+	}
+	s.Count++
+	s.Bytes += h.p.w.n
+	h.p.mu.Unlock()
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a SizeProfiler sharing the receiver's measurements.
+func (h *SizeProfiler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	return &h2
+}
+
+// WithGroup returns a SizeProfiler sharing the receiver's measurements.
+func (h *SizeProfiler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	return &h2
+}
+
+// report logs the topN messages by total size since the last report, then resets the measurements.
+func (p *sizeProfile) report(interval time.Duration, topN int) {
+	p.mu.Lock()
+	stats := make([]SizeStat, 0, len(p.stats))
+	var totalBytes, totalCount int
+	for _, s := range p.stats {
+		stats = append(stats, *s)
+		totalBytes += s.Bytes
+		totalCount += s.Count
+	}
+	p.stats = make(map[string]*SizeStat, len(p.stats))
+	p.mu.Unlock()
+	if totalCount == 0 {
+		return
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Bytes > stats[j].Bytes })
+	if len(stats) > topN {
+		stats = stats[:topN]
+	}
+	for i := range stats {
+		stats[i].Share = float64(stats[i].Bytes) / float64(totalBytes)
+	}
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "log size profile", 0)
+	r.AddAttrs(
+		slog.Int("total_bytes", totalBytes),
+		slog.Int("total_records", totalCount),
+		slog.Duration("interval", interval),
+		slog.Any("top", stats),
+	)
+	_ = p.next.Handle(context.Background(), r)
+}
@@ -0,0 +1,43 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSizeProfiler(t *testing.T) {
+	next := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := NewSizeProfiler(ctx, next, time.Hour, 1)
+	l := slog.New(h)
+	for i := 0; i < 3; i++ {
+		l.Info("small")
+	}
+	l.Info("big", "payload", strings.Repeat("x", 1000))
+	if got := len(next.get()); got != 4 {
+		t.Fatalf("passed through %d records, want 4", got)
+	}
+
+	h.p.report(time.Hour, 1) // as the ticker would.
+	got := next.get()
+	if len(got) != 5 || got[4].Message != "log size profile" {
+		t.Fatalf("got %d records, want the 4 logged and a profile", len(got))
+	}
+	a := attrsOf(got[4])
+	top, _ := a["top"].Any().([]SizeStat)
+	if a["total_records"].Int64() != 4 || len(top) != 1 || top[0].Msg != "big" || top[0].Count != 1 || top[0].Bytes < 1000 {
+		t.Errorf("profile = %v, want the big record on top", a)
+	}
+	if int64(top[0].Bytes) >= a["total_bytes"].Int64() || top[0].Share <= 0.5 || top[0].Share >= 1 {
+		t.Errorf("top = %+v of %v bytes: want most but not all of them", top[0], a["total_bytes"])
+	}
+
+	h.p.report(time.Hour, 1) // the measurements were reset: nothing to report.
+	if got := len(next.get()); got != 5 {
+		t.Errorf("got %d records after an empty interval, want no new profile", got)
+	}
+}
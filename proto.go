@@ -0,0 +1,250 @@
+package rplog
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// protoSchemaVersion is the version of the LogRecord schema in rplog.proto that protoHandler writes.
+const protoSchemaVersion = 1
+
+// InitProto is like Init, but ships records to a collector as length-delimited Protobuf over TCP rather than writing JSON,
+// to save bandwidth and parse cost in high-volume services. See rplog.proto for the schema.
+// It dials endpoint (host:port) immediately, returning an error if it can't connect.
+// Afterwards, records are queued and written by a background goroutine, so that logging never waits on the network (see Flush):
+// a full queue, or a failed write, drops the record. A failed write closes the connection, and the next record redials,
+// backing off (up to 30s) while the collector is unreachable, and dropping records meanwhile.
+// The connection is closed when ctx is done, after which records are dropped.
+// As with Init, it's OK to use nil for the metadata.
+func InitProto(ctx context.Context, endpoint string, m *Metadata) error {
+	c := &protoConn{ctx: ctx, endpoint: endpoint, queue: make(chan []byte, protoQueueSize)}
+	if err := c.dial(); err != nil {
+		return fmt.Errorf("rplog.InitProto: %w", err)
+	}
+	go c.run()
+	initHandler(m, func(opts *slog.HandlerOptions) slog.Handler { return &protoHandler{opts: *opts, conn: c} })
+	health.sink.Store("proto")
+	health.proto.Store(c)
+	return nil
+}
+
+const (
+	protoQueueSize    = 4096            // records waiting to be written, past which they're dropped.
+	protoDialTimeout  = 5 * time.Second // for each dial.
+	protoWriteTimeout = 5 * time.Second // for each record: a collector that stops reading mustn't stall the queue forever.
+	protoMinBackoff   = 250 * time.Millisecond
+	protoMaxBackoff   = 30 * time.Second // between failed dials.
+)
+
+// protoConn is a lazily-redialed TCP connection to a Protobuf log collector, written by the goroutine running run.
+type protoConn struct {
+	ctx      context.Context
+	endpoint string
+	queue    chan []byte
+
+	// owned by run.
+	conn      net.Conn    // nil if not connected.
+	stopClose func() bool // stops closing conn when c.ctx is done: see dial.
+	backoff   time.Duration
+	nextDial  time.Time // while the endpoint is unreachable, records are dropped rather than redialing until then.
+
+	// for HealthHandler.
+	connected atomic.Bool
+	dropped   atomic.Int64 // records dropped: the queue was full, or their write failed.
+	lastWrite atomic.Int64 // when a record was last written, in Unix nanoseconds.
+}
+
+// write queues b to be written by run, or drops it if the queue is full.
+func (c *protoConn) write(b []byte) error {
+	pending.Add(1) // see Flush.
+	select {
+	case c.queue <- b:
+		return nil
+	default:
+		pending.Done()
+		c.dropped.Add(1)
+		return errors.New("rplog: proto queue full: record dropped")
+	}
+}
+
+// run writes the queued records until the process exits: once c.ctx is done, it drops them instead.
+func (c *protoConn) run() {
+	for b := range c.queue {
+		if err := c.send(b); err != nil {
+			c.dropped.Add(1)
+		} else {
+			c.lastWrite.Store(time.Now().UnixNano())
+		}
+		pending.Done()
+	}
+}
+
+// send writes b in full, dialing first if necessary. On failure, the connection is closed so that the next record redials.
+func (c *protoConn) send(b []byte) error {
+	if err := c.ctx.Err(); err != nil {
+		c.close()
+		return err
+	}
+	if c.conn == nil {
+		if time.Now().Before(c.nextDial) {
+			return errors.New("rplog: proto collector unreachable: backing off")
+		}
+		if err := c.dial(); err != nil {
+			c.backoff = min(max(2*c.backoff, protoMinBackoff), protoMaxBackoff)
+			c.nextDial = time.Now().Add(c.backoff)
+			return err
+		}
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(protoWriteTimeout))
+	if _, err := c.conn.Write(b); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// dial connects to the endpoint.
+func (c *protoConn) dial() error {
+	d := net.Dialer{Timeout: protoDialTimeout}
+	conn, err := d.DialContext(c.ctx, "tcp", c.endpoint)
+	if err != nil {
+		return err
+	}
+	c.conn, c.backoff = conn, 0
+	c.stopClose = context.AfterFunc(c.ctx, func() { conn.Close() }) // even mid-write.
+	c.connected.Store(true)
+	return nil
+}
+
+func (c *protoConn) close() {
+	if c.conn != nil {
+		c.stopClose()
+		c.conn.Close()
+		c.conn = nil
+		c.connected.Store(false)
+	}
+}
+
+// protoHandler is a slog.Handler encoding records as rplog.v1.LogRecord.
+type protoHandler struct {
+	opts   slog.HandlerOptions
+	groups []string   // currently open groups, for ReplaceAttr.
+	attrs  []flatAttr // preformatted by WithAttrs.
+	conn   *protoConn
+}
+
+// flatAttr is an attribute flattened by flattenAttrs.
+type flatAttr struct{ key, val string }
+
+func (h *protoHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	minLvl := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLvl = h.opts.Level.Level()
+	}
+	return lvl >= minLvl
+}
+
+func (h *protoHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = flattenAttrs(h.attrs[:len(h.attrs):len(h.attrs)], h.opts.ReplaceAttr, h.groups, attrs)
+	return &h2
+}
+
+func (h *protoHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+func (h *protoHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := r.Message
+	if h.opts.ReplaceAttr != nil {
+		if a := h.opts.ReplaceAttr(nil, slog.String(slog.MessageKey, msg)); a.Value.Kind() == slog.KindString {
+			msg = a.Value.String()
+		}
+	}
+	attrs := h.attrs[:len(h.attrs):len(h.attrs)] // h.attrs is shared by concurrent calls: don't append into its spare capacity.
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = flattenAttrs(attrs, h.opts.ReplaceAttr, h.groups, []slog.Attr{a})
+		return true
+	})
+
+	var b []byte
+	b = protoVarintField(b, 1, protoSchemaVersion)
+	b = protoVarintField(b, 2, uint64(r.Time.UnixNano()))
+	b = protoStringField(b, 3, r.Level.String())
+	b = protoStringField(b, 4, msg)
+	for _, a := range attrs {
+		var entry []byte
+		entry = protoStringField(entry, 1, a.key)
+		entry = protoStringField(entry, 2, a.val)
+		b = protoBytesField(b, 5, entry)
+	}
+	if h.opts.AddSource && r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		b = protoStringField(b, 6, fmt.Sprintf("%s:%d", f.File, f.Line))
+	}
+	frame := binary.AppendUvarint(make([]byte, 0, len(b)+binary.MaxVarintLen64), uint64(len(b)))
+	return h.conn.write(append(frame, b...))
+}
+
+// flattenAttrs resolves and flattens attrs within groups into dotted keys, applying replace (if not nil) to each.
+func flattenAttrs(dst []flatAttr, replace replacer, groups []string, attrs []slog.Attr) []flatAttr {
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() != slog.KindGroup && replace != nil {
+			a = replace(groups, a)
+			a.Value = a.Value.Resolve()
+		}
+		switch {
+		case a.Equal(slog.Attr{}):
+			continue
+		case a.Value.Kind() == slog.KindGroup:
+			inner := groups
+			if a.Key != "" {
+				inner = append(groups[:len(groups):len(groups)], a.Key)
+			}
+			dst = flattenAttrs(dst, replace, inner, a.Value.Group())
+		default:
+			key := a.Key
+			for i := len(groups) - 1; i >= 0; i-- {
+				key = groups[i] + "." + key
+			}
+			dst = append(dst, flatAttr{key: key, val: a.Value.String()})
+		}
+	}
+	return dst
+}
+
+// Protobuf wire format: see https://protobuf.dev/programming-guides/encoding/.
+const (
+	protoWireVarint = 0
+	protoWireBytes  = 2
+)
+
+func protoVarintField(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func protoBytesField(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func protoStringField(b []byte, field int, v string) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|protoWireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,174 @@
+package rplog
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitProto(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := InitProto(ctx, ln.Addr().String(), &Metadata{Service: "svc"}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	slog.Warn("hello", slog.Group("g", "k", "v"))
+
+	// skip the "rplog initialized" record: the second one is ours.
+	r := bufio.NewReader(conn)
+	var fields map[int][]string
+	for i := 0; i < 2; i++ {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		fields = decodeProto(t, b)
+	}
+	if got := fields[3]; len(got) != 1 || got[0] != "WARN" {
+		t.Errorf("level = %q, want WARN", got)
+	}
+	if got := fields[4]; len(got) != 1 || got[0] != "hello" {
+		t.Errorf("msg = %q, want hello", got)
+	}
+	attrs := make(map[string]string)
+	for _, entry := range fields[5] {
+		kv := decodeProto(t, []byte(entry))
+		attrs[kv[1][0]] = kv[2][0]
+	}
+	if attrs["g.k"] != "v" || attrs["service"] != "svc" {
+		t.Errorf("attrs = %v, want g.k=v and service=svc", attrs)
+	}
+}
+
+// records logged concurrently must each keep their own attributes: run with -race.
+func TestInitProtoConcurrent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := InitProto(ctx, ln.Addr().String(), &Metadata{Service: "svc"}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const workers, records = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				slog.Info(strconv.Itoa(w), "worker", w, "i", i)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < 1+workers*records; i++ { // and the "rplog initialized" record.
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		fields := decodeProto(t, b)
+		if fields[4][0] == "rplog initialized" {
+			continue
+		}
+		attrs := make(map[string][]string)
+		for _, entry := range fields[5] {
+			kv := decodeProto(t, []byte(entry))
+			attrs[kv[1][0]] = append(attrs[kv[1][0]], kv[2][0])
+		}
+		if w := attrs["worker"]; len(w) != 1 || w[0] != fields[4][0] || len(attrs["i"]) != 1 || attrs["service"][0] != "svc" {
+			t.Fatalf("record %q has attrs %v", fields[4][0], attrs)
+		}
+	}
+}
+
+// decodeProto decodes the varint and length-delimited fields of a Protobuf message, formatting varints in decimal.
+func decodeProto(t *testing.T, b []byte) map[int][]string {
+	t.Helper()
+	fields := make(map[int][]string)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		switch tag & 7 {
+		case protoWireVarint:
+			v, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[int(tag>>3)] = append(fields[int(tag>>3)], strconv.FormatUint(v, 10))
+		case protoWireBytes:
+			l, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[int(tag>>3)] = append(fields[int(tag>>3)], string(b[:l]))
+			b = b[l:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+	return fields
+}
+
+// a collector that stops reading must cost records, not stall the callers logging them.
+func TestInitProtoStalledCollector(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := InitProto(ctx, ln.Addr().String(), nil); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept() // and never read from it.
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	big := strings.Repeat("x", 64<<10)
+	for i := 0; i < 2*protoQueueSize; i++ {
+		slog.Info("flood", "big", big)
+	}
+	if elapsed := time.Since(start); elapsed > protoWriteTimeout {
+		t.Errorf("logging took %v with a stalled collector", elapsed)
+	}
+	if c := health.proto.Load(); c.dropped.Load() == 0 {
+		t.Error("no records dropped with a stalled collector")
+	}
+}
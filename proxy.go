@@ -0,0 +1,84 @@
+package rplog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/runpod/rplog/trace"
+)
+
+// LogProxy configures p to log each proxied request under the incoming request's Trace:
+// the backend's status (or the error reaching it), the backend host, and the backend's latency in `backend_elapsed_ms`.
+// It wraps p's Transport (or http.DefaultTransport, if it's nil) with trace.ClientMiddleware, so the Trace is propagated to the backend,
+// and sets p's ModifyResponse and ErrorHandler, calling any already set after logging. If no ErrorHandler was set, errors respond 502 Bad Gateway, as usual.
+// The incoming request should have been through trace.ServerMiddleware. LogProxy returns p.
+//
+// Example Usage:
+//
+//	p := rplog.LogProxy(httputil.NewSingleHostReverseProxy(backend))
+//	http.ListenAndServe(":8080", trace.ServerMiddleware(p))
+func LogProxy(p *httputil.ReverseProxy) *httputil.ReverseProxy {
+	rt := p.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	p.Transport = trace.ClientMiddleware(proxyTimer{rt})
+
+	modify := p.ModifyResponse
+	p.ModifyResponse = func(resp *http.Response) error {
+		attrs := []slog.Attr{slog.String("backend", resp.Request.URL.Host), slog.Int("status", resp.StatusCode)}
+		if start, ok := resp.Request.Context().Value(ctxKey[proxyStart]{}).(proxyStart); ok {
+			attrs = append(attrs, slog.Int64("backend_elapsed_ms", time.Since(time.Time(start)).Milliseconds()))
+		}
+		slog.LogAttrs(resp.Request.Context(), slog.LevelInfo, "proxied request", attrs...)
+		if modify != nil {
+			return modify(resp)
+		}
+		return nil
+	}
+
+	handleErr := p.ErrorHandler
+	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		attrs := []slog.Attr{slog.String("backend", r.URL.Host), slog.String("err", err.Error())}
+		var be *backendError
+		if errors.As(err, &be) {
+			attrs = append(attrs, slog.Int64("backend_elapsed_ms", be.elapsed.Milliseconds()))
+		}
+		slog.LogAttrs(r.Context(), slog.LevelError, "proxy error", attrs...)
+		if handleErr != nil {
+			handleErr(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return p
+}
+
+// proxyStart is when proxyTimer sent a request to the backend.
+type proxyStart time.Time
+
+// proxyTimer is a RoundTripper recording when each request was sent to the backend, for LogProxy.
+// On success, the time is in the context of the response's Request; on failure, the error is a *backendError.
+type proxyTimer struct{ rt http.RoundTripper }
+
+func (t proxyTimer) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(r.WithContext(context.WithValue(r.Context(), ctxKey[proxyStart]{}, proxyStart(start))))
+	if err != nil {
+		return nil, &backendError{err: err, elapsed: time.Since(start)}
+	}
+	return resp, nil
+}
+
+// backendError is an error from the backend's RoundTripper, with how long it took to fail.
+type backendError struct {
+	err     error
+	elapsed time.Duration
+}
+
+func (e *backendError) Error() string { return e.err.Error() }
+func (e *backendError) Unwrap() error { return e.err }
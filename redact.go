@@ -0,0 +1,112 @@
+package rplog
+
+import (
+	"log/slog"
+	"regexp"
+	"sync/atomic"
+)
+
+// redacted replaces substrings matching a redaction pattern.
+const redacted = "[REDACTED]"
+
+// DefaultRedactPatterns match common PII and secrets: email addresses, credit card numbers (13-19 digits, optionally separated by spaces or dashes,
+// that pass the Luhn check, so that other long numbers like IDs and timestamps are left alone), and AWS access key IDs.
+// Pass them to SetRedactPatterns, along with any of your own.
+var DefaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	cardNumberPattern,
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+}
+
+// cardNumberPattern matches candidate card numbers: only those passing luhn are redacted. See MatchesRedactPattern.
+var cardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// MatchesRedactPattern reports whether SetRedactPatterns would redact any of s with p: whether p matches s,
+// except that the card number pattern of DefaultRedactPatterns only matches numbers passing the Luhn check.
+func MatchesRedactPattern(p *regexp.Regexp, s string) bool {
+	if p != cardNumberPattern {
+		return p.MatchString(s)
+	}
+	for _, m := range p.FindAllString(s, -1) {
+		if luhn(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// luhn reports whether the digits of s (ignoring spaces and dashes) pass the Luhn checksum of card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ' ' || s[i] == '-' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+var redactPatterns atomic.Pointer[[]*regexp.Regexp]
+
+// SetRedactPatterns replaces every substring matching one of patterns with "[REDACTED]" in the message and string attribute values
+// (including error messages) of every subsequent record, regardless of the attribute's key:
+//
+//	rplog.SetRedactPatterns(rplog.DefaultRedactPatterns)
+//
+// Redaction is off by default, since every pattern runs against every string of every record: expect a cost of roughly
+// a few hundred nanoseconds per pattern per string. Attributes added via slog.Logger.With are redacted when With is called,
+// using the patterns in effect at that time. nil (or an empty slice) turns redaction off.
+func SetRedactPatterns(patterns []*regexp.Regexp) {
+	if len(patterns) == 0 {
+		redactPatterns.Store(nil)
+		return
+	}
+	patterns = append([]*regexp.Regexp(nil), patterns...) // don't let the caller mutate them under us.
+	redactPatterns.Store(&patterns)
+}
+
+// redact is a ReplaceAttr transform applying the patterns set by SetRedactPatterns.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	patterns := redactPatterns.Load()
+	if patterns == nil {
+		return a
+	}
+	var s string
+	switch a.Value.Kind() {
+	case slog.KindString:
+		s = a.Value.String()
+	case slog.KindAny:
+		err, ok := a.Value.Any().(error)
+		if !ok {
+			return a
+		}
+		s = err.Error()
+	default:
+		return a
+	}
+	r := s
+	for _, p := range *patterns {
+		if p == cardNumberPattern {
+			r = p.ReplaceAllStringFunc(r, func(m string) string {
+				if luhn(m) {
+					return redacted
+				}
+				return m
+			})
+			continue
+		}
+		r = p.ReplaceAllLiteralString(r, redacted)
+	}
+	if r == s && a.Value.Kind() == slog.KindString {
+		return a
+	}
+	return slog.String(a.Key, r)
+}
@@ -0,0 +1,96 @@
+package rplog
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// replacer is a slog.HandlerOptions.ReplaceAttr transform.
+type replacer = func(groups []string, a slog.Attr) slog.Attr
+
+// chain composes the non-nil replacers into one, applying them in order. It returns nil if there are none.
+func chain(rs ...replacer) replacer {
+	var nonNil []replacer
+	for _, r := range rs {
+		if r != nil {
+			nonNil = append(nonNil, r)
+		}
+	}
+	if len(nonNil) == 0 {
+		return nil
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		for _, r := range nonNil {
+			a = r(groups, a)
+		}
+		return a
+	}
+}
+
+// parseList parses a comma-separated list, ignoring surrounding whitespace and empty elements.
+func parseList(s string) ([]string, error) {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list, nil
+}
+
+// stringifyInts renders integers as JSON strings rather than numbers, to preserve their precision for consumers
+// (like JavaScript-based log viewers) that parse numbers as float64 and lose precision past 2^53.
+// It applies to integer attributes whose key is listed in RUNPOD_LOG_STRING_INT_KEYS (comma-separated),
+// and to any integer whose magnitude exceeds RUNPOD_LOG_STRING_INT_ABOVE (if set).
+// It returns nil if neither is configured, since numeric aggregations downstream depend on numbers staying numbers.
+func stringifyInts() replacer {
+	keys := make(map[string]bool)
+	for _, k := range env.Or(parseList, "RUNPOD_LOG_STRING_INT_KEYS", nil) {
+		keys[k] = true
+	}
+	above := env.Uint64Or("RUNPOD_LOG_STRING_INT_ABOVE", 0)
+	if len(keys) == 0 && above == 0 {
+		return nil
+	}
+	return func(_ []string, a slog.Attr) slog.Attr {
+		switch a.Value.Kind() {
+		case slog.KindInt64:
+			n := a.Value.Int64()
+			mag := uint64(n)
+			if n < 0 {
+				mag = uint64(-n)
+			}
+			if keys[a.Key] || (above != 0 && mag > above) {
+				return slog.String(a.Key, strconv.FormatInt(n, 10))
+			}
+		case slog.KindUint64:
+			if n := a.Value.Uint64(); keys[a.Key] || (above != 0 && n > above) {
+				return slog.String(a.Key, strconv.FormatUint(n, 10))
+			}
+		}
+		return a
+	}
+}
+
+// normalizeTime converts each record's time to the timezone named by RUNPOD_LOG_TIMEZONE (an IANA name, like America/New_York; default UTC),
+// so that every service's logs share one timezone regardless of the host's settings.
+func normalizeTime() replacer {
+	loc := time.UTC
+	if name := env.StringOr("RUNPOD_LOG_TIMEZONE", "UTC"); name != "UTC" {
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			slog.Warn("unknown RUNPOD_LOG_TIMEZONE: falling back to UTC", slog.String("timezone", name), slog.String("err", err.Error()))
+			loc = time.UTC
+		}
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+			a.Value = slog.TimeValue(a.Value.Time().In(loc))
+		}
+		return a
+	}
+}
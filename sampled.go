@@ -0,0 +1,65 @@
+//go:build !rplog_nodeps
+
+package rplog
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// maxSampledKeys bounds the number of keys SampledByKey tracks. Beyond it, the least-recently-used key is forgotten.
+const maxSampledKeys = 10_000
+
+// keyLimiters is a bounded LRU cache of per-key rate limiters.
+var keyLimiters = struct {
+	sync.Mutex
+	order *list.List // of *keyLimiter, most-recently-used first
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: make(map[string]*list.Element)}
+
+type keyLimiter struct {
+	key string
+	*rate.Limiter
+}
+
+// SampledByKey logs msg at INFO at most limit times per second per key (e.g, per client IP or user ID),
+// so that a single noisy entity can't flood the logs while still leaving evidence of its behavior.
+// The args are handled as in slog.Logger.Info.
+//
+// This is per-entity throttling, not global rate limiting: each key has its own token bucket, with a burst of at least one log.
+// At most 10,000 keys are tracked at once; the least-recently-seen are forgotten first.
+// It's unavailable when built with the rplog_nodeps tag, as it depends on golang.org/x/time/rate.
+func SampledByKey(ctx context.Context, key string, limit rate.Limit, msg string, args ...any) {
+	if !limiterFor(key, limit).Allow() {
+		return
+	}
+	logAt(ctx, 1, slog.LevelInfo, msg, args...)
+}
+
+// limiterFor returns the limiter for key, creating it (and evicting the least-recently-used limiter, if necessary) if it doesn't exist.
+func limiterFor(key string, limit rate.Limit) *rate.Limiter {
+	keyLimiters.Lock()
+	defer keyLimiters.Unlock()
+	if e, ok := keyLimiters.byKey[key]; ok {
+		keyLimiters.order.MoveToFront(e)
+		l := e.Value.(*keyLimiter)
+		if l.Limit() != limit {
+			l.SetLimit(limit)
+		}
+		return l.Limiter
+	}
+	if keyLimiters.order.Len() >= maxSampledKeys {
+		oldest := keyLimiters.order.Back()
+		keyLimiters.order.Remove(oldest)
+		delete(keyLimiters.byKey, oldest.Value.(*keyLimiter).key)
+	}
+	burst := int(math.Max(1, math.Ceil(float64(limit))))
+	l := &keyLimiter{key: key, Limiter: rate.NewLimiter(limit, burst)}
+	keyLimiters.byKey[key] = keyLimiters.order.PushFront(l)
+	return l.Limiter
+}
@@ -0,0 +1,57 @@
+//go:build !rplog_nodeps
+
+package rplog
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"testing"
+)
+
+// resetKeyLimiters empties the cache of SampledByKey's limiters.
+func resetKeyLimiters() {
+	keyLimiters.Lock()
+	defer keyLimiters.Unlock()
+	keyLimiters.order = list.New()
+	keyLimiters.byKey = make(map[string]*list.Element)
+}
+
+func TestSampledByKey(t *testing.T) {
+	resetKeyLimiters()
+	t.Cleanup(resetKeyLimiters)
+	rec := recordDefault(t)
+	for i := 0; i < 5; i++ {
+		SampledByKey(context.Background(), "noisy", 1, "hit", "key", "noisy")
+	}
+	SampledByKey(context.Background(), "quiet", 1, "hit", "key", "quiet")
+
+	counts := make(map[string]int)
+	for _, r := range rec.get() {
+		counts[attrsOf(r)["key"].String()]++
+	}
+	if counts["noisy"] != 1 || counts["quiet"] != 1 {
+		t.Errorf("records by key = %v, want one each: throttling one key must not affect another", counts)
+	}
+}
+
+func TestLimiterForEvictsOldest(t *testing.T) {
+	resetKeyLimiters()
+	t.Cleanup(resetKeyLimiters)
+	for i := 0; i < maxSampledKeys; i++ {
+		limiterFor(strconv.Itoa(i), 1)
+	}
+	limiterFor("0", 1) // now the most recently used: "1" is the oldest.
+	limiterFor("new", 1)
+
+	keyLimiters.Lock()
+	defer keyLimiters.Unlock()
+	if n := len(keyLimiters.byKey); n != maxSampledKeys || keyLimiters.order.Len() != maxSampledKeys {
+		t.Errorf("tracking %d keys, want %d", n, maxSampledKeys)
+	}
+	for key, want := range map[string]bool{"0": true, "1": false, "2": true, "new": true} {
+		if _, ok := keyLimiters.byKey[key]; ok != want {
+			t.Errorf("key %q tracked = %v, want %v", key, ok, want)
+		}
+	}
+}
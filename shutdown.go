@@ -0,0 +1,62 @@
+package rplog
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pending tracks work that must finish before the process exits for its records to be delivered, like the webhook alerts of InitWebhookAlerts
+// and the records queued by InitProto. See Flush.
+var pending sync.WaitGroup
+
+// shutdownFlushTimeout bounds how long HandleShutdownSignals, and Go after a panic, wait for Flush.
+const shutdownFlushTimeout = 5 * time.Second
+
+// Flush waits until any records still being delivered in the background (e.g, webhook alerts, or the records queued by InitProto; see InitWebhookAlerts)
+// have been delivered, or until ctx is done, in which case it returns ctx.Err(). Call it before exiting, or use HandleShutdownSignals.
+// Records written via Init are written synchronously, so they never need flushing.
+func Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HandleShutdownSignals installs a handler for SIGTERM and SIGINT that logs ShuttingDown with the signal as the reason and Flushes (for at most 5 seconds),
+// so that records aren't lost on the usual Kubernetes-sends-SIGTERM path. It's opt-in: call it once, early in main.
+//
+// Then, if next is nil, the signal is re-raised with its default behavior restored, terminating the process as if the handler had never been installed.
+// Otherwise, next is called with the signal instead, and is responsible for shutting down: an application that handles these signals itself
+// should pass its handler as next rather than calling signal.Notify for them too, so that it runs after the logs are flushed.
+func HandleShutdownSignals(next func(os.Signal)) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-c
+		ctx := context.Background()
+		ShuttingDown(ctx, sig.String())
+		ctx, cancel := context.WithTimeout(ctx, shutdownFlushTimeout)
+		_ = Flush(ctx)
+		cancel()
+		if next != nil {
+			next(sig)
+			return
+		}
+		signal.Stop(c)
+		signal.Reset(sig)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			_ = p.Signal(sig)
+		}
+	}()
+}
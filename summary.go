@@ -0,0 +1,145 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// SummarizingHandler wraps a slog.Handler, aggregating known-noisy errors.
+// Records at ERROR or above whose message matches one of its patterns aren't passed through:
+// they're counted by fingerprint (message + error type), and every window a single summary record per fingerprint is emitted instead,
+// with the count and the first- and last-seen times. The error type is the record's error_type attribute, or else the dynamic type of an error value
+// logged as err or error: it's empty for an error logged by its message, as LogErr does.
+// Everything else passes straight through, so genuinely novel errors still log individually.
+//
+// Attributes added via slog.Logger.With are not carried onto the summary records.
+//
+// Example Usage:
+//
+//	noisy := regexp.MustCompile(`^failed to reach redis`)
+//	slog.SetDefault(slog.New(rplog.NewSummarizingHandler(ctx, slog.Default().Handler(), time.Minute, noisy)))
+type SummarizingHandler struct {
+	slog.Handler
+	patterns []*regexp.Regexp
+	s        *summaries // shared among handlers derived via WithAttrs and WithGroup
+}
+
+type fingerprint struct{ msg, errType string }
+
+type summary struct {
+	count       int
+	first, last time.Time
+}
+
+type summaries struct {
+	mu   sync.Mutex
+	m    map[fingerprint]*summary
+	next slog.Handler // the handler passed to NewSummarizingHandler, which receives the summaries.
+}
+
+// NewSummarizingHandler returns a SummarizingHandler wrapping next, which emits summaries every window until ctx is done,
+// at which point it emits any remaining summaries and stops.
+func NewSummarizingHandler(ctx context.Context, next slog.Handler, window time.Duration, patterns ...*regexp.Regexp) *SummarizingHandler {
+	h := &SummarizingHandler{
+		Handler:  next,
+		patterns: patterns,
+		s:        &summaries{m: make(map[fingerprint]*summary), next: next},
+	}
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				h.s.flush(window)
+				return
+			case <-ticker.C:
+				h.s.flush(window)
+			}
+		}
+	}()
+	return h
+}
+
+// Handle counts records matching one of the handler's patterns and passes through everything else.
+func (h *SummarizingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelError || !h.matches(r.Message) {
+		return h.Handler.Handle(ctx, r)
+	}
+	fp := fingerprint{msg: r.Message, errType: errType(r)}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	s, ok := h.s.m[fp]
+	if !ok {
+		s = &summary{first: r.Time}
+		h.s.m[fp] = s
+	}
+	s.count++
+	s.last = r.Time
+	return nil
+}
+
+// WithAttrs returns a SummarizingHandler sharing the receiver's counts.
+func (h *SummarizingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	return &h2
+}
+
+// WithGroup returns a SummarizingHandler sharing the receiver's counts.
+func (h *SummarizingHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	return &h2
+}
+
+func (h *SummarizingHandler) matches(msg string) bool {
+	for _, p := range h.patterns {
+		if p.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush emits one summary record per fingerprint seen since the last flush, then resets the counts.
+func (s *summaries) flush(window time.Duration) {
+	s.mu.Lock()
+	m := s.m
+	s.m = make(map[fingerprint]*summary, len(m))
+	s.mu.Unlock()
+	for fp, sum := range m {
+		r := slog.NewRecord(time.Now(), slog.LevelError, "error summary", 0)
+		r.AddAttrs(
+			slog.String("summarized_msg", fp.msg),
+			slog.String("error_type", fp.errType),
+			slog.Int("count", sum.count),
+			slog.Time("first_seen", sum.first),
+			slog.Time("last_seen", sum.last),
+			slog.Duration("window", window),
+		)
+		_ = s.next.Handle(context.Background(), r)
+	}
+}
+
+// errType returns the record's error_type attribute, if it has one, or else the dynamic type of the error in its err or error attribute.
+// An error logged by its message, as slog.String (like LogErr does), has no type to report: errType then returns "".
+func errType(r slog.Record) (typ string) {
+	r.Attrs(func(a slog.Attr) bool {
+		switch {
+		case a.Key == "error_type":
+			typ = a.Value.String()
+			return false
+		case (a.Key == "err" || a.Key == "error") && typ == "" && a.Value.Kind() == slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				typ = fmt.Sprintf("%T", err)
+			}
+		}
+		return true
+	})
+	return typ
+}
@@ -0,0 +1,101 @@
+package rplog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a slog.Handler keeping the records it handles.
+type recorder struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (r *recorder) Enabled(context.Context, slog.Level) bool { return true }
+func (r *recorder) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *recorder) WithGroup(string) slog.Handler            { return r }
+func (r *recorder) Handle(_ context.Context, rec slog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec.Clone())
+	return nil
+}
+
+func (r *recorder) get() []slog.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]slog.Record(nil), r.records...)
+}
+
+// attrsOf returns the attributes of r by key, resolved.
+func attrsOf(r slog.Record) map[string]slog.Value {
+	m := make(map[string]slog.Value, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value.Resolve()
+		return true
+	})
+	return m
+}
+
+func TestSummarizingHandler(t *testing.T) {
+	next := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := slog.New(NewSummarizingHandler(ctx, next, time.Hour, regexp.MustCompile(`^failed to reach redis`)))
+
+	for i := 0; i < 3; i++ {
+		l.Error("failed to reach redis", "err", errors.New("timeout"))
+	}
+	l.With("k", "v").Error("failed to reach redis", "error_type", "dns") // a separate fingerprint, sharing the counts.
+	l.Warn("failed to reach redis")                                      // below ERROR: passes through.
+	l.Error("novel failure")                                             // no pattern matches: passes through.
+	if got := next.get(); len(got) != 2 || got[0].Message != "failed to reach redis" || got[1].Message != "novel failure" {
+		t.Fatalf("passed through %d records, want the WARN and the novel ERROR", len(got))
+	}
+
+	cancel() // flushes the summaries.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(next.get()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	counts := make(map[string]int64)
+	for _, r := range next.get()[2:] {
+		a := attrsOf(r)
+		if r.Message != "error summary" || a["summarized_msg"].String() != "failed to reach redis" {
+			t.Errorf("unexpected summary %q: %v", r.Message, a)
+		}
+		counts[a["error_type"].String()] = a["count"].Int64()
+	}
+	if want := map[string]int64{"*errors.errorString": 3, "dns": 1}; len(counts) != len(want) || counts["*errors.errorString"] != 3 || counts["dns"] != 1 {
+		t.Errorf("summary counts = %v, want %v", counts, want)
+	}
+}
+
+// errors logged as strings, as LogErr does, have no type: they're fingerprinted by message alone, rather than as "String".
+func TestSummarizingHandlerLogErr(t *testing.T) {
+	next := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	prev := slog.Default()
+	slog.SetDefault(slog.New(NewSummarizingHandler(ctx, next, time.Hour, regexp.MustCompile(`^failed to reach redis`))))
+	defer slog.SetDefault(prev)
+
+	LogErr(context.Background(), "failed to reach redis", errors.New("timeout"))
+	LogErr(context.Background(), "failed to reach redis", fmt.Errorf("dial: %w", errors.New("refused")))
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(next.get()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	got := next.get()
+	if len(got) != 1 {
+		t.Fatalf("got %d summaries, want one", len(got))
+	}
+	if a := attrsOf(got[0]); a["error_type"].String() != "" || a["count"].Int64() != 2 {
+		t.Errorf("summary = %v, want count 2 and no error_type", a)
+	}
+}
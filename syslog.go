@@ -0,0 +1,225 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// SyslogOptions configure a SyslogHandler. The zero value is usable.
+type SyslogOptions struct {
+	Facility int          // syslog facility, e.g 16 for local0. Default 1 (user-level).
+	AppName  string       // APP-NAME header field. Default RUNPOD_SERVICE_NAME or "-".
+	Hostname string       // HOSTNAME header field. Default os.Hostname() or "-".
+	SDID     string       // the SD-ID of the structured-data element holding the attributes. Default "rplog@32473".
+	Level    slog.Leveler // minimum level to log. Default INFO.
+}
+
+// SyslogHandler is a slog.Handler writing RFC 5424 syslog messages, with the record's attributes encoded natively as
+// an RFC 5424 SD-ELEMENT (rather than as JSON in the message), for SIEMs that parse structured data:
+//
+//	<134>1 2024-01-02T03:04:05.000000Z myhost myservice 1234 - [rplog@32473 trace_id="..." level="INFO"] request completed
+//
+// Groups are flattened into dotted parameter names. Wrap it in a Handler to add the Trace:
+//
+//	slog.SetDefault(slog.New(&rplog.Handler{Handler: rplog.NewSyslogHandler(conn, nil)}))
+type SyslogHandler struct {
+	opts   SyslogOptions
+	procID string
+	prefix string      // group prefix for attributes, ending in "." if non-empty
+	attrs  []slog.Attr // preformatted: keys already prefixed
+	mu     *sync.Mutex
+	w      io.Writer
+}
+
+// NewSyslogHandler returns a SyslogHandler writing one message per record to w. opts may be nil.
+func NewSyslogHandler(w io.Writer, opts *SyslogOptions) *SyslogHandler {
+	h := &SyslogHandler{w: w, mu: new(sync.Mutex), procID: fmt.Sprint(os.Getpid())}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Facility == 0 {
+		h.opts.Facility = 1
+	}
+	if h.opts.AppName == "" {
+		h.opts.AppName = env.StringOr("RUNPOD_SERVICE_NAME", "")
+	}
+	if h.opts.Hostname == "" {
+		h.opts.Hostname, _ = os.Hostname()
+	}
+	if h.opts.SDID == "" {
+		h.opts.SDID = "rplog@32473"
+	}
+	if h.opts.Level == nil {
+		h.opts.Level = slog.LevelInfo
+	}
+	return h
+}
+
+// Enabled reports whether lvl is at or above the handler's minimum level.
+func (h *SyslogHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return lvl >= h.opts.Level.Level()
+}
+
+// WithAttrs returns a SyslogHandler that includes attrs in every message.
+func (h *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(h.attrs[:len(h.attrs):len(h.attrs)], flatten(h.prefix, attrs)...)
+	return &h2
+}
+
+// WithGroup returns a SyslogHandler that prefixes subsequent attribute names with name.
+func (h *SyslogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// Handle writes r as a single RFC 5424 message.
+func (h *SyslogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append(h.attrs[:len(h.attrs):len(h.attrs)], slog.String("level", r.Level.String()))
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, flatten(h.prefix, []slog.Attr{a})...)
+		return true
+	})
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var msg strings.Builder
+	escapeControl(&msg, r.Message) // a newline in the message would otherwise split it into (or forge) another syslog message.
+	line := fmt.Sprintf("<%d>1 %s %s %s %s - %s %s\n",
+		h.opts.Facility*8+syslogSeverity(r.Level),
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(h.opts.Hostname, 255),
+		headerField(h.opts.AppName, 48),
+		headerField(h.procID, 128),
+		SDElement(h.opts.SDID, attrs...),
+		msg.String(),
+	)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line)
+	return err
+}
+
+// SDElement formats attrs as an RFC 5424 SD-ELEMENT: [id name="value" ...].
+// The id and names are sanitized into valid SD-NAMEs (at most 32 printable US-ASCII characters, excluding '=', ' ', ']', and '"'),
+// and values are escaped per RFC 5424 section 6.3.3: '"', '\', and ']' are preceded by a backslash. Control characters are escaped as in escapeControl.
+// Group attributes must already be flattened (see SyslogHandler); any that aren't are formatted as their slog string representation.
+func SDElement(id string, attrs ...slog.Attr) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	b.WriteString(sdName(id, 32))
+	for _, a := range attrs {
+		b.WriteByte(' ')
+		b.WriteString(sdName(a.Key, 32))
+		b.WriteString(`="`)
+		sdEscape(&b, a.Value.Resolve().String())
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// flatten resolves attrs, inlining groups as dotted names under prefix.
+func flatten(prefix string, attrs []slog.Attr) []slog.Attr {
+	var out []slog.Attr
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		switch {
+		case a.Equal(slog.Attr{}):
+			continue
+		case a.Value.Kind() == slog.KindGroup:
+			groupPrefix := prefix
+			if a.Key != "" {
+				groupPrefix += a.Key + "."
+			}
+			out = append(out, flatten(groupPrefix, a.Value.Group())...)
+		default:
+			out = append(out, slog.Attr{Key: prefix + a.Key, Value: a.Value})
+		}
+	}
+	return out
+}
+
+// sdName replaces characters that aren't allowed in an SD-NAME with '_' and truncates it to max characters.
+func sdName(s string, max int) string {
+	if s == "" {
+		return "_"
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if c < '!' || c > '~' || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	return string(b)
+}
+
+// sdEscape writes s to b as an SD PARAM-VALUE, escaping '"', '\', and ']', and control characters as in escapeControl.
+func sdEscape(b *strings.Builder, s string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\\', ']':
+			escapeControl(b, s[start:i])
+			b.WriteByte('\\')
+			start = i
+		}
+	}
+	escapeControl(b, s[start:])
+}
+
+// escapeControl writes s to b with its ASCII control characters escaped Go-style (\n, \t, \x00, ...), so that it stays on one line.
+func escapeControl(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// headerField formats s as an RFC 5424 header field: printable US-ASCII only, at most max characters, and "-" if empty.
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	return sdName(s, max)
+}
+
+// syslogSeverity maps a slog level onto an RFC 5424 severity.
+func syslogSeverity(lvl slog.Level) int {
+	switch {
+	case lvl >= slog.LevelError:
+		return 3 // error
+	case lvl >= slog.LevelWarn:
+		return 4 // warning
+	case lvl >= slog.LevelInfo:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
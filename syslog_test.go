@@ -0,0 +1,59 @@
+package rplog
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSDElementEscaping(t *testing.T) {
+	for _, tt := range []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("k", "plain"), `[id k="plain"]`},
+		{slog.String("k", `say "hi"`), `[id k="say \"hi\""]`},
+		{slog.String("k", `C:\path`), `[id k="C:\\path"]`},
+		{slog.String("k", `a]b`), `[id k="a\]b"]`},
+		{slog.String("k", `\"]`), `[id k="\\\"\]"]`},
+		{slog.String("k", "ünïcode"), `[id k="ünïcode"]`},
+		{slog.Int("n", 42), `[id n="42"]`},
+		{slog.String("k", "two\nlines\x00"), `[id k="two\nlines\x00"]`},
+		{slog.String(`bad key="]`, "v"), `[id bad_key___="v"]`},
+		{slog.String(strings.Repeat("k", 40), "v"), `[id ` + strings.Repeat("k", 32) + `="v"]`},
+	} {
+		if got := SDElement("id", tt.attr); got != tt.want {
+			t.Errorf("SDElement(%v) = %s, want %s", tt.attr, got, tt.want)
+		}
+	}
+	if got, want := SDElement(strings.Repeat("i", 40)+"@32473"), "["+strings.Repeat("i", 32)+"]"; got != want {
+		t.Errorf("SDElement with a long id = %s, want %s: an SD-ID has at most 32 characters", got, want)
+	}
+}
+
+func TestSyslogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewSyslogHandler(&buf, &SyslogOptions{Facility: 16, AppName: "svc", Hostname: "host"})
+	l := slog.New(h).With("a", 1).WithGroup("g")
+	l.Warn("careful", "b", "x]y", slog.Group("sub", "c", true))
+
+	line := buf.String()
+	re := regexp.MustCompile(`^<132>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z host svc \d+ - \[rplog@32473 a="1" level="WARN" g\.b="x\\]y" g\.sub\.c="true"\] careful\n$`)
+	if !re.MatchString(line) {
+		t.Errorf("unexpected syslog line: %q", line)
+	}
+	if ts := strings.Fields(line)[1]; !strings.HasSuffix(ts, "Z") {
+		t.Errorf("timestamp %q should be UTC", ts)
+	} else if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		t.Errorf("timestamp %q: %v", ts, err)
+	}
+
+	buf.Reset()
+	l.Info("forged\n<131>1 - host svc 1 - - injected")
+	if line := buf.String(); strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, ` forged\n<131>1 - host svc 1 - - injected`+"\n") {
+		t.Errorf("a newline in the message must not start another syslog message: %q", line)
+	}
+}
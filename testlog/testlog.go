@@ -0,0 +1,119 @@
+// Package testlog provides test-time helpers for code that logs via rplog and slog.
+package testlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/runpod/rplog"
+)
+
+// GuardPII fails t if any record logged via slog's default logger during the test has a message or string value matching one of patterns
+// (rplog.DefaultRedactPatterns, if none are given). Records are still passed on to the previous default handler.
+// It restores the previous default logger when the test finishes. Call it at the start of a test, after rplog.Init:
+// wrapping slog's built-in default handler deadlocks, since that handler writes via the log package, which slog.SetDefault redirects back into slog.
+//
+// Unlike rplog.SetRedactPatterns, which masks PII at runtime, this catches the leak during development so the logging call can be fixed.
+// Values are checked before any runtime redaction is applied.
+func GuardPII(t testing.TB, patterns ...*regexp.Regexp) {
+	t.Helper()
+	if len(patterns) == 0 {
+		patterns = rplog.DefaultRedactPatterns
+	}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(&piiGuard{Handler: prev.Handler(), t: t, patterns: patterns}))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+}
+
+// piiGuard is a slog.Handler that reports PII in records to a test before passing them on.
+type piiGuard struct {
+	slog.Handler
+	t        testing.TB
+	patterns []*regexp.Regexp
+}
+
+func (g *piiGuard) Handle(ctx context.Context, r slog.Record) error {
+	g.check("msg", r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		g.checkAttr("", a)
+		return true
+	})
+	return g.Handler.Handle(ctx, r)
+}
+
+func (g *piiGuard) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for _, a := range attrs {
+		g.checkAttr("", a)
+	}
+	return &piiGuard{Handler: g.Handler.WithAttrs(attrs), t: g.t, patterns: g.patterns}
+}
+
+func (g *piiGuard) WithGroup(name string) slog.Handler {
+	return &piiGuard{Handler: g.Handler.WithGroup(name), t: g.t, patterns: g.patterns}
+}
+
+// checkAttr checks the string values of a and any attributes nested within it.
+func (g *piiGuard) checkAttr(prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		for _, ga := range v.Group() {
+			g.checkAttr(prefix+a.Key+".", ga)
+		}
+	case slog.KindString:
+		g.check(prefix+a.Key, v.String())
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			g.check(prefix+a.Key, err.Error())
+		}
+	}
+}
+
+func (g *piiGuard) check(key, s string) {
+	for _, p := range g.patterns {
+		if rplog.MatchesRedactPattern(p, s) {
+			g.t.Errorf("testlog: logged PII matching %s under key %q", p, key)
+		}
+	}
+}
+
+// New returns a logger writing to t.Log, so that test code can log via the same API as production and see the output in `go test -v`
+// under the right test. Records are written as text at DEBUG and above, with the Trace and other attributes of rplog.Handler, but not the metadata.
+//
+// t.Log attributes each line to this package, since slog's frames can't be marked as test helpers:
+// the `source` attribute (file:line) points at the logging call instead.
+func New(t testing.TB) *slog.Logger {
+	base := slog.NewTextHandler(tWriter{t}, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey: // t.Log output is already ordered: the time is noise.
+				return slog.Attr{}
+			case slog.SourceKey:
+				if src, ok := a.Value.Any().(*slog.Source); ok {
+					return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+				}
+			}
+			return a
+		},
+	})
+	return slog.New(&rplog.Handler{Handler: base})
+}
+
+// tWriter writes each record, as written in one call by slog's TextHandler, to t.Log.
+type tWriter struct{ t testing.TB }
+
+func (w tWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
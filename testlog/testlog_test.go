@@ -0,0 +1,53 @@
+package testlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/runpod/rplog"
+	"github.com/runpod/rplog/trace"
+)
+
+// fakeT records failures and logs instead of failing the test or writing them.
+type fakeT struct {
+	testing.TB
+	failures int
+	logs     []string
+}
+
+func (f *fakeT) Helper()               {}
+func (f *fakeT) Errorf(string, ...any) { f.failures++ }
+func (f *fakeT) Cleanup(fn func())     { f.TB.Cleanup(fn) }
+func (f *fakeT) Log(args ...any)       { f.logs = append(f.logs, fmt.Sprint(args...)) }
+
+func TestGuardPII(t *testing.T) {
+	rplog.Init(nil, io.Discard)
+	ft := &fakeT{TB: t}
+	GuardPII(ft)
+	slog.Info("nothing to see here", "user_id", 42)
+	if ft.failures != 0 {
+		t.Fatalf("clean record reported %d failures", ft.failures)
+	}
+	slog.With("contact", "bob@example.com").Info("signup", slog.Group("card", "number", "4111-1111-1111-1111"))
+	if ft.failures != 2 {
+		t.Errorf("got %d failures, want 2 (email and card number)", ft.failures)
+	}
+}
+
+func TestNew(t *testing.T) {
+	ft := &fakeT{TB: t}
+	ctx := trace.CtxWith(context.Background(), trace.Trace{TraceID: "abc", RequestID: "def"})
+	New(ft).DebugContext(ctx, "hello", "k", "v")
+	if len(ft.logs) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(ft.logs), ft.logs)
+	}
+	for _, want := range []string{"level=DEBUG", "source=testlog_test.go:", "msg=hello", "k=v", "trace_id=abc"} {
+		if !strings.Contains(ft.logs[0], want) {
+			t.Errorf("line %q is missing %q", ft.logs[0], want)
+		}
+	}
+}
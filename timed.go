@@ -0,0 +1,38 @@
+package rplog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/runpod/rplog/internal/env"
+	"github.com/runpod/rplog/trace"
+)
+
+// timedFloor is the duration below which Timed logs nothing: see RUNPOD_LOG_TIMED_FLOOR.
+var timedFloor = env.DurationOr("RUNPOD_LOG_TIMED_FLOOR", 0)
+
+// Timed runs fn and logs how long it took, with the Trace from ctx and name as the operation:
+// a warning if it took longer than threshold, or otherwise an info record, unless it took less than RUNPOD_LOG_TIMED_FLOOR (read at startup), in which case nothing is logged.
+// It returns fn's error unchanged, logging it as "error" alongside elapsed_ms.
+// Use it to spot slow paths in internal calls and expensive computations, as one would slow requests with the HTTP middleware.
+//
+//	err := rplog.Timed(ctx, "rebuild index", 500*time.Millisecond, func() error { return idx.Rebuild() })
+func Timed(ctx context.Context, name string, threshold time.Duration, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	if elapsed < timedFloor {
+		return err
+	}
+	lvl, msg := slog.LevelInfo, "timed operation finished"
+	if elapsed > threshold {
+		lvl, msg = slog.LevelWarn, "timed operation slow"
+	}
+	args := []any{slog.Int64("elapsed_ms", elapsed.Milliseconds()), slog.Duration("threshold", threshold)}
+	if err != nil {
+		args = append(args, slog.Any("error", err))
+	}
+	logAt(trace.WithOperation(ctx, name), 1, lvl, msg, args...)
+	return err
+}
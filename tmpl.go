@@ -0,0 +1,46 @@
+package rplog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Tmpl logs at lvl a message rendered from tmpl, in which each {key} is replaced by the value of the attribute with that key,
+// along with the attributes themselves, so a record carries both a readable message and its structured fields from one list of args.
+// The args are as for slog.Logger.Log. Interpolated values are redacted as they would be logged (see SetRedactPatterns);
+// placeholders without a matching attribute are left as they are. The template itself is logged as `msg_template`, for grouping records by it.
+//
+//	rplog.Tmpl(ctx, slog.LevelInfo, "user {user} logged in from {ip}", "user", u, "ip", ip)
+func Tmpl(ctx context.Context, lvl slog.Level, tmpl string, args ...any) {
+	if !slog.Default().Enabled(ctx, lvl) {
+		return
+	}
+	r := slog.NewRecord(time.Time{}, lvl, "", 0)
+	r.Add(args...)
+	vals := make(map[string]slog.Attr, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		vals[a.Key] = a
+		return true
+	})
+	var b strings.Builder
+	for rest := tmpl; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		end := strings.IndexByte(rest[open+1:], '}')
+		if open < 0 || end < 0 {
+			b.WriteString(rest)
+			break
+		}
+		key := rest[open+1 : open+1+end]
+		if a, ok := vals[key]; ok {
+			b.WriteString(rest[:open])
+			fmt.Fprint(&b, plainValue(a))
+		} else {
+			b.WriteString(rest[:open+1+end+1])
+		}
+		rest = rest[open+1+end+1:]
+	}
+	logAt(ctx, 1, lvl, b.String(), append(args[:len(args):len(args)], slog.String("msg_template", tmpl))...)
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// B3 (Zipkin) propagation support, for migrating from Zipkin-instrumented services: see https://github.com/openzipkin/b3-propagation.
+// The TraceID and RequestID map onto the B3 trace and span IDs as in Trace.OTelIDs. Only the multi-header form is supported, not the single b3 header.
+
+// Propagation selects the headers that ServerMiddleware reads and ClientMiddleware writes, in addition to our own X-Trace-* headers. See WithPropagation.
+type Propagation int
+
+const (
+	Native Propagation = iota // only the X-Trace-* headers (and X-Amzn-Trace-Id): the default.
+	B3                        // also the X-B3-* headers of Zipkin: see FromHeaderB3 and SaveToHeaderB3.
+)
+
+// WithPropagation has ServerMiddleware and ClientMiddleware also read and write the headers of another tracing system, for interop during a migration.
+// With B3, ServerMiddleware prefers the X-B3-* headers, falling back to our own if they're absent or malformed (see FromHeaderB3),
+// and ClientMiddleware writes both.
+//
+// Example Usage:
+//
+//	trace.ServerMiddleware(h, trace.WithPropagation(trace.B3))
+func WithPropagation(p Propagation) Option {
+	return func(o *options) { o.prop = p }
+}
+
+// SaveToHeaderB3 writes the Trace to h as B3 headers: X-B3-TraceId (128-bit), X-B3-SpanId, and X-B3-Sampled, as a sampled trace. See Trace.OTelIDs for the mapping.
+// Unlike SaveToHeader, it writes none of the X-Trace-* headers. ClientMiddleware also writes X-B3-ParentSpanId when the request has a parent.
+func SaveToHeaderB3(h http.Header, t Trace) {
+	traceID, spanID := t.OTelIDs()
+	h.Set("X-B3-TraceId", hex.EncodeToString(traceID[:]))
+	h.Set("X-B3-SpanId", hex.EncodeToString(spanID[:]))
+	h.Set("X-B3-Sampled", "1")
+}
+
+// FromHeaderB3 returns a Trace from the B3 headers in h: the X-B3-TraceId as the TraceID and the X-B3-SpanId as the RequestID, as in FromOTelIDs.
+// A 64-bit trace ID is taken as the low half of a 128-bit one, per the B3 spec. X-B3-ParentSpanId is ignored: a Trace has no parent span.
+// If the headers are missing or malformed, it falls back to FromHeaderOrNew.
+func FromHeaderB3(h http.Header) Trace {
+	return fromHeaderB3(h, FromHeaderOrNew)
+}
+
+// fromHeaderB3 is FromHeaderB3, falling back to fallback instead.
+func fromHeaderB3(h http.Header, fallback func(http.Header) Trace) Trace {
+	traceID, spanID, ok := parseB3(h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId"))
+	if !ok {
+		return fallback(h)
+	}
+	return FromOTelIDs(traceID, spanID)
+}
+
+// parseB3 parses the B3 trace ID, of 16 or 32 hex digits, and span ID, of 16. All-zero IDs are invalid.
+func parseB3(traceHex, spanHex string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	if len(traceHex) != 16 && len(traceHex) != 32 || len(spanHex) != 16 || !isHex(traceHex) || !isHex(spanHex) {
+		return traceID, spanID, false
+	}
+	if strings.Trim(traceHex, "0") == "" || strings.Trim(spanHex, "0") == "" {
+		return traceID, spanID, false
+	}
+	hex.Decode(traceID[16-len(traceHex)/2:], []byte(strings.ToLower(traceHex)))
+	hex.Decode(spanID[:], []byte(strings.ToLower(spanHex)))
+	return traceID, spanID, true
+}
@@ -0,0 +1,69 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromHeaderB3(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		traceID, spanID    string
+		native             string
+		wantTrace, wantReq string
+	}{
+		{"128-bit", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", "", "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", "00f067aa0ba902b7"},
+		{"64-bit", "a3ce929d0e0e4736", "00f067aa0ba902b7", "", "00000000-0000-0000-a3ce-929d0e0e4736", "00f067aa0ba902b7"},
+		{"uppercase", "A3CE929D0E0E4736", "00F067AA0BA902B7", "", "00000000-0000-0000-a3ce-929d0e0e4736", "00f067aa0ba902b7"},
+		{"absent: native", "", "", "native-trace", "native-trace", ""},
+		{"malformed: native", "a3ce929d0e0e473", "00f067aa0ba902b7", "native-trace", "native-trace", ""},
+		{"zero: native", "0000000000000000", "00f067aa0ba902b7", "native-trace", "native-trace", ""},
+	} {
+		h := make(http.Header)
+		for k, v := range map[string]string{"X-B3-TraceId": tt.traceID, "X-B3-SpanId": tt.spanID, "X-Trace-ID": tt.native} {
+			if v != "" {
+				h.Set(k, v)
+			}
+		}
+		got := FromHeaderB3(h)
+		if got.TraceID != tt.wantTrace || tt.wantReq != "" && got.RequestID != tt.wantReq {
+			t.Errorf("%s: got IDs %q, %q, want %q, %q", tt.name, got.TraceID, got.RequestID, tt.wantTrace, tt.wantReq)
+		}
+	}
+}
+
+func TestB3Middleware(t *testing.T) {
+	var inbound Trace
+	var outbound http.Header
+	client := &http.Client{Transport: ClientMiddleware(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		outbound = r.Header
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	}), WithPropagation(B3))}
+	h := ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inbound, _ = FromCtx(r.Context())
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://downstream/", nil)
+		client.Do(req)
+	}), WithPropagation(B3))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-B3-TraceId", "4bf92f3577b34da6a3ce929d0e0e4736")
+	r.Header.Set("X-B3-SpanId", "00f067aa0ba902b7")
+	h.ServeHTTP(httptest.NewRecorder(), r.WithContext(context.Background()))
+	if inbound.TraceID != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+		t.Errorf("inbound TraceID = %q, want it from X-B3-TraceId", inbound.TraceID)
+	}
+	for k, want := range map[string]string{
+		"X-B3-TraceId":      "4bf92f3577b34da6a3ce929d0e0e4736",
+		"X-B3-ParentSpanId": "00f067aa0ba902b7",
+		"X-Trace-ID":        inbound.TraceID,
+	} {
+		if got := outbound.Get(k); got != want {
+			t.Errorf("outbound %s = %q, want %q", k, got, want)
+		}
+	}
+	if span := outbound.Get("X-B3-SpanId"); len(span) != 16 || span == "00f067aa0ba902b7" {
+		t.Errorf("outbound X-B3-SpanId = %q, want a new span", span)
+	}
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"context"
+	"sync"
+)
+
+// maxCalls bounds the downstream calls recorded per request.
+const maxCalls = 64
+
+// Call is a downstream call made via ClientMiddleware, as recorded for the request it was made on behalf of.
+type Call struct {
+	Service   string `json:"service"`       // the host called.
+	Status    int    `json:"status"`        // the response's status code, or 0 if the call failed.
+	ElapsedMs int64  `json:"elapsed_ms"`    // how long the call took to respond (or fail).
+	Err       string `json:"err,omitempty"` // why the call failed, if it did.
+}
+
+// calls records the downstream calls of a request. It's safe for concurrent use, since a request may fan out.
+type calls struct {
+	mu      sync.Mutex
+	list    []Call
+	dropped int  // calls past maxCalls.
+	logged  bool // see MarkDownstreamCallsLogged.
+}
+
+func (c *calls) add(call Call) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.list) >= maxCalls {
+		c.dropped++
+		return
+	}
+	c.list = append(c.list, call)
+}
+
+// DownstreamCalls returns the calls made so far via ClientMiddleware on behalf of the request being served by ServerMiddleware,
+// and how many more were made but not recorded, as at most 64 are.
+func DownstreamCalls(ctx context.Context) (list []Call, dropped int) {
+	c, ok := ctx.Value(ctxKey[*calls]{}).(*calls)
+	if !ok {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.list...), c.dropped
+}
+
+// MarkDownstreamCallsLogged records that the request's downstream calls have been logged on its completion record (as rplog.Consolidate does),
+// so that ServerMiddleware doesn't log them a second time.
+func MarkDownstreamCallsLogged(ctx context.Context) {
+	if c, ok := ctx.Value(ctxKey[*calls]{}).(*calls); ok {
+		c.mu.Lock()
+		c.logged = true
+		c.mu.Unlock()
+	}
+}
+
+// unlogged returns the calls recorded and dropped, like DownstreamCalls, unless they've been logged already: see MarkDownstreamCallsLogged.
+func (c *calls) unlogged() (list []Call, dropped int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.logged {
+		return nil, 0
+	}
+	return append([]Call(nil), c.list...), c.dropped
+}
@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDownstreamCallsCap(t *testing.T) {
+	const workers, each = 8, 20 // more than maxCalls in all.
+	var c calls
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				c.add(Call{Service: "svc", Status: 200})
+			}
+		}()
+	}
+	wg.Wait()
+	ctx := context.WithValue(context.Background(), ctxKey[*calls]{}, &c)
+	list, dropped := DownstreamCalls(ctx)
+	if len(list) != maxCalls || dropped != workers*each-maxCalls {
+		t.Errorf("DownstreamCalls: %d calls, %d dropped; want %d, %d", len(list), dropped, maxCalls, workers*each-maxCalls)
+	}
+	// the list returned is a copy.
+	list[0].Service = "changed"
+	if list, _ := DownstreamCalls(ctx); list[0].Service != "svc" {
+		t.Error("DownstreamCalls returned the collector's own list")
+	}
+}
+
+// a request fanning out records every call, from whichever goroutine makes it: run with -race.
+func TestDownstreamCallsConcurrent(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	client := NewClient(nil)
+	var list []Call
+	ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequestWithContext(r.Context(), "GET", backend.URL, nil)
+				if resp, err := client.Do(req); err == nil {
+					resp.Body.Close()
+				}
+			}()
+		}
+		wg.Wait()
+		list, _ = DownstreamCalls(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(list) != 8 {
+		t.Errorf("DownstreamCalls: %d calls, want 8", len(list))
+	}
+}
@@ -0,0 +1,26 @@
+package trace
+
+import (
+	"context"
+	"net"
+)
+
+// connID identifies the connection a request arrived on: see ConnContext.
+type connID string
+
+// ConnContext is an http.Server.ConnContext hook giving each connection a unique ID, which the rplog Handler logs as `conn_id`
+// on the records of every request served over it: useful to see which requests shared an HTTP/2 connection,
+// when debugging head-of-line blocking or connection-level failures.
+//
+// Example Usage:
+//
+//	srv := &http.Server{Addr: ":8080", Handler: trace.ServerMiddleware(h), ConnContext: trace.ConnContext}
+func ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, ctxKey[connID]{}, connID(NewID()))
+}
+
+// ConnIDFromCtx returns the ID ConnContext gave the connection of the request being served, if it exists.
+func ConnIDFromCtx(ctx context.Context) (id string, ok bool) {
+	c, ok := ctx.Value(ctxKey[connID]{}).(connID)
+	return string(c), ok
+}
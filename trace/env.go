@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// EnvFrom returns environment variables carrying the Trace in ctx (or a new one, if it has none) to a child process,
+// for use in exec.Cmd.Env:
+//
+//	cmd := exec.CommandContext(ctx, "worker")
+//	cmd.Env = append(os.Environ(), trace.EnvFrom(ctx)...)
+//
+// As with ClientMiddleware, the child gets a new RequestID. The variables are named after the headers SaveToHeader writes,
+// e.g, X-Trace-ID becomes RUNPOD_TRACE_ID and X-Request-ID becomes RUNPOD_REQUEST_ID.
+func EnvFrom(ctx context.Context) []string {
+	t, ok := FromCtx(ctx)
+	if !ok {
+		t = New()
+	} else {
+		t.RequestID = NewID()
+	}
+	h := make(http.Header)
+	SaveToHeader(h, t)
+	env := make([]string, 0, len(h))
+	for _, k := range traceHeaders {
+		if v := h.Get(k); v != "" {
+			env = append(env, envName(k)+"="+v)
+		}
+	}
+	return env
+}
+
+// FromEnv returns the Trace passed to this process by its parent via EnvFrom, if it exists.
+// Store it in your root context at startup so that it flows into all of the child's logs:
+//
+//	ctx := context.Background()
+//	if t, ok := trace.FromEnv(); ok {
+//		ctx = trace.CtxWith(ctx, t)
+//	}
+func FromEnv() (t Trace, ok bool) {
+	if os.Getenv(envName("X-Trace-ID")) == "" {
+		return Trace{}, false
+	}
+	h := make(http.Header)
+	for _, k := range traceHeaders {
+		if v := os.Getenv(envName(k)); v != "" {
+			h.Set(k, v)
+		}
+	}
+	return FromHeaderOrNew(h), true
+}
+
+// envName converts a trace header's name into the name of the environment variable that carries it: X-Trace-ID -> RUNPOD_TRACE_ID.
+func envName(header string) string {
+	return "RUNPOD_" + strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(header, "X-"), "-", "_"))
+}
@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvRoundTrip(t *testing.T) {
+	for _, k := range traceHeaders {
+		t.Setenv(envName(k), "")
+	}
+	if _, ok := FromEnv(); ok {
+		t.Fatal("FromEnv: ok = true without RUNPOD_TRACE_ID")
+	}
+
+	parent := New()
+	parent.TraceSource = "billing"
+	env := EnvFrom(CtxWith(context.Background(), parent))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	got, ok := FromEnv()
+	if !ok {
+		t.Fatalf("FromEnv: ok = false with %v", env)
+	}
+	if got.TraceID != parent.TraceID || got.TraceSource != "billing" || !got.TraceStart.Equal(parent.TraceStart.Truncate(time.Second)) {
+		t.Errorf("FromEnv() = %+v, want the TraceID, TraceSource, and TraceStart of %+v", got, parent)
+	}
+	if got.RequestID == parent.RequestID || got.RequestID == "" {
+		t.Errorf("FromEnv().RequestID = %q, want a new one", got.RequestID)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for header, want := range map[string]string{
+		"X-Trace-ID":      "RUNPOD_TRACE_ID",
+		"X-Request-ID":    "RUNPOD_REQUEST_ID",
+		"X-Prev-Trace-ID": "RUNPOD_PREV_TRACE_ID",
+		"X-Amzn-Trace-Id": "RUNPOD_AMZN_TRACE_ID",
+	} {
+		if got := envName(header); got != want {
+			t.Errorf("envName(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/runpod/rplog/internal/id"
+)
+
+// job is the name of the job in progress, as set by RunJob.
+type job string
+
+// JobFromCtx returns the name of the job run by RunJob, if it exists.
+func JobFromCtx(ctx context.Context) (name string, ok bool) {
+	j, ok := ctx.Value(ctxKey[job]{}).(job)
+	return string(j), ok
+}
+
+// RunJob gives a scheduled or background job the correlation that ServerMiddleware gives HTTP requests.
+// It runs fn with a context holding a fresh Trace and the job's name (which the rplog Handler logs as `job`),
+// logging the job's start and its end (with the duration and outcome), and returns fn's error.
+//
+// Example Usage:
+//
+//	for range time.Tick(time.Hour) {
+//		_ = trace.RunJob(ctx, "cleanup-expired-sessions", cleanup)
+//	}
+func RunJob(ctx context.Context, name string, fn func(context.Context) error) error {
+	ctx = context.WithValue(CtxWith(ctx, New()), ctxKey[job]{}, job(name))
+	start := time.Now()
+	slog.InfoContext(ctx, "job started")
+	err := fn(ctx)
+	elapsed := slog.Int64("job_elapsed_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		slog.ErrorContext(ctx, "job failed", elapsed, slog.String("outcome", "error"), slog.String("err", err.Error()))
+		return err
+	}
+	slog.InfoContext(ctx, "job completed", elapsed, slog.String("outcome", "ok"))
+	return nil
+}
+
+// jobRunNamespace is the UUID namespace of the TraceIDs derived by NewJobRun.
+var jobRunNamespace = id.NewSHA1(id.NameSpaceURL, []byte("https://github.com/runpod/rplog/trace#NewJobRun"))
+
+// NewJobRun returns a Trace for a run of a batch job that may checkpoint and restart: its TraceID is derived from runID,
+// the caller's stable ID for the run, so that the logs of every restart of the same run share it.
+// The RequestID is fresh, distinguishing the attempts, and the TraceStart and RequestStart are now, the start of this attempt.
+//
+// The TraceID is the name-based (version 5) UUID of runID, so it's the same across processes, services, and versions of this package.
+func NewJobRun(runID string) Trace {
+	t := New()
+	t.TraceID = id.NewSHA1(jobRunNamespace, []byte(runID)).String()
+	return t
+}
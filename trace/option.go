@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/netip"
+)
+
+// Option configures ServerMiddleware or ClientMiddleware.
+type Option func(*options)
+
+type options struct {
+	trusted  []netip.Prefix // see WithTrustedNetworks.
+	forward  []string       // see ForwardHeaders.
+	sampling bool           // whether WithSampleRate was given.
+	sample   float64        // see WithSampleRate.
+	extIDs   []string       // see WithExternalIDs.
+	prop     Propagation    // see WithPropagation.
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithTrustedNetworks has ServerMiddleware trust the X-Trace-Source and X-Request-Source headers of requests from the given networks:
+// typically, those of internal services. By default, no network is trusted, and the TraceSource and RequestSource of every inbound request are cleared,
+// so that an external client can't claim to be an internal service.
+//
+// Example Usage:
+//
+//	trace.ServerMiddleware(h, trace.WithTrustedNetworks(netip.MustParsePrefix("10.0.0.0/8")))
+func WithTrustedNetworks(networks ...netip.Prefix) Option {
+	return func(o *options) { o.trusted = append(o.trusted, networks...) }
+}
+
+// ForwardHeaders has ClientMiddleware copy the given headers (e.g, "X-Tenant-ID", "Accept-Language") from the inbound request that ServerMiddleware
+// stored in the outbound request's context, if there is one, onto the outbound request, unless it already sets them.
+// Only the listed headers are forwarded: list them explicitly, and never sensitive ones like Authorization.
+//
+// Example Usage:
+//
+//	http.DefaultClient.Transport = trace.ClientMiddleware(http.DefaultTransport, trace.ForwardHeaders("X-Tenant-ID"))
+func ForwardHeaders(names ...string) Option {
+	return func(o *options) { o.forward = append(o.forward, names...) }
+}
+
+// WithSampleRate has ServerMiddleware sample traces at rate (between 0 and 1): the logs of a sampled-out trace are dropped,
+// except for errors, while those of a sampled-in trace are all kept, so that a request's logs are either complete or absent.
+// The decision is a deterministic function of the TraceID, so every service sampling at the same rate makes the same one for a trace.
+// A rate of 0 or below (or NaN) samples out every trace, keeping only errors; a rate of 1 or above keeps every trace. See SampledFromCtx.
+func WithSampleRate(rate float64) Option {
+	if !(rate > 0) {
+		rate = 0
+	}
+	return func(o *options) { o.sample, o.sampling = min(rate, 1), true }
+}
+
+// WithExternalIDs has ServerMiddleware capture the correlation IDs of external systems (e.g, a partner's X-Correlation-ID) from the given request headers,
+// which the rplog Handler logs in the `external_ids` group, keyed by header name, to cross-reference our traces with theirs.
+// As with our own IDs, values that are too long or contain invalid characters are ignored. See ExternalIDsFromCtx.
+func WithExternalIDs(headers ...string) Option {
+	return func(o *options) { o.extIDs = append(o.extIDs, headers...) }
+}
+
+// keep reports whether the trace with the given ID is sampled in, per WithSampleRate.
+func (o *options) keep(traceID string) bool {
+	if o.sample >= 1 {
+		return true
+	}
+	if o.sample <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	return float64(h.Sum64())/(1<<64) < o.sample
+}
+
+// trustedSource reports whether r comes from a trusted network, per WithTrustedNetworks.
+func (o *options) trustedSource(r *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, p := range o.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"encoding/hex"
+
+	"github.com/runpod/rplog/internal/id"
+)
+
+// This package doesn't depend on OpenTelemetry, so it can't read or write the SpanContext in a context.Context itself.
+// Instead, OTelIDs and FromOTelIDs convert between a Trace and OpenTelemetry's IDs; bridging is then a couple of lines:
+//
+//	traceID, spanID := t.OTelIDs()
+//	ctx = oteltrace.ContextWithSpanContext(ctx, oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+//
+//	sc := oteltrace.SpanContextFromContext(ctx)
+//	ctx = trace.CtxWith(ctx, trace.FromOTelIDs(sc.TraceID(), sc.SpanID()))
+
+// OTelIDs maps the Trace onto OpenTelemetry's 16-byte trace ID and 8-byte span ID. The mapping is deterministic:
+//
+//	trace ID: the last 32 hex digits of the TraceID, ignoring any other characters: for a UUID, its 16 bytes.
+//	span ID:  the last 16 hex digits of the RequestID: for a UUID, its last 8 (random) bytes.
+//
+// An ID with too few hex digits maps onto the leading bytes of its SHA-256 instead, as in ToXRay.
+func (t Trace) OTelIDs() (traceID [16]byte, spanID [8]byte) {
+	hex.Decode(traceID[:], []byte(lastHex(t.TraceID, 32)))
+	hex.Decode(spanID[:], []byte(lastHex(t.RequestID, 16)))
+	return traceID, spanID
+}
+
+// FromOTelIDs returns a Trace from OpenTelemetry's trace and span IDs: the TraceID is the trace ID formatted as a UUID,
+// and the RequestID is the span ID in hex. It inverts OTelIDs for the trace ID of a UUID TraceID, but not for the span ID,
+// since a span ID is only half a UUID.
+// The sources and start times are those of New.
+func FromOTelIDs(traceID [16]byte, spanID [8]byte) Trace {
+	t := New()
+	t.TraceID = id.UUID(traceID).String()
+	t.RequestID = hex.EncodeToString(spanID[:])
+	return t
+}
@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// Span is a timed sub-operation of a request, such as one layer of a call stack: see StartSpan.
+// The rplog Handler logs the innermost Span in the context as `span_id`, `parent_span_id`, and `span_name`,
+// so the logs of a request can be told apart by the sub-operation that wrote them.
+type Span struct {
+	ID       string    // 16 random hex digits, as an OpenTelemetry span ID.
+	ParentID string    // the ID of the enclosing Span, if any.
+	Name     string    // as passed to StartSpan.
+	Start    time.Time // when StartSpan was called.
+
+	ctx context.Context // the span's own context, for End.
+}
+
+// StartSpan starts a Span named name, as a child of the Span in ctx, if there is one, and returns a context holding it.
+// The Span belongs to the Trace in ctx, whose TraceID and RequestID it keeps; if ctx has no Trace, it gets a new one.
+// Call End when the sub-operation finishes.
+//
+// Example Usage:
+//
+//	ctx, span := trace.StartSpan(ctx, "load user")
+//	defer span.End()
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	if _, ok := FromCtx(ctx); !ok {
+		ctx = CtxWith(ctx, New())
+	}
+	s := Span{ID: newSpanID(), Name: name, Start: time.Now()}
+	if parent, ok := SpanFromCtx(ctx); ok {
+		s.ParentID = parent.ID
+	}
+	s.ctx = context.WithValue(ctx, ctxKey[Span]{}, s)
+	return s.ctx, s
+}
+
+// End logs the Span's end, with its duration as `span_elapsed_ms`, at debug level.
+func (s Span) End() {
+	if s.ctx == nil {
+		return // a zero Span: not started by StartSpan.
+	}
+	slog.DebugContext(s.ctx, "span ended", slog.Int64("span_elapsed_ms", time.Since(s.Start).Milliseconds()))
+}
+
+// SpanFromCtx returns the innermost Span started by StartSpan, if it exists.
+func SpanFromCtx(ctx context.Context) (s Span, ok bool) {
+	s, ok = ctx.Value(ctxKey[Span]{}).(Span)
+	return s, ok
+}
+
+func newSpanID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
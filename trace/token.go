@@ -0,0 +1,41 @@
+package trace
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tokenVersion is the current version of the Token encoding. Bump it (and keep parsing the old versions) to evolve the format.
+const tokenVersion = "1"
+
+// Token returns a compact, URL-safe "correlation token" encoding the TraceID, RequestID, and TraceSource:
+// everything needed to find a request's logs, as one string for error responses and support tickets.
+// Parse it with ParseTraceToken. Timestamps are not encoded.
+//
+// The format is "{version}.{base64url(TraceID \n RequestID \n TraceSource)}".
+func (t Trace) Token() string {
+	return tokenVersion + "." + base64.RawURLEncoding.EncodeToString([]byte(t.TraceID+"\n"+t.RequestID+"\n"+t.TraceSource))
+}
+
+// ParseTraceToken parses a token produced by Trace.Token.
+// The resulting Trace has only its TraceID, RequestID, and TraceSource set.
+func ParseTraceToken(token string) (Trace, error) {
+	version, payload, ok := strings.Cut(token, ".")
+	if !ok {
+		return Trace{}, errors.New("trace token: missing version")
+	}
+	if version != tokenVersion {
+		return Trace{}, fmt.Errorf("trace token: unsupported version %q", version)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Trace{}, fmt.Errorf("trace token: %w", err)
+	}
+	fields := strings.SplitN(string(b), "\n", 3)
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+		return Trace{}, errors.New("trace token: malformed payload")
+	}
+	return Trace{TraceID: fields[0], RequestID: fields[1], TraceSource: fields[2]}, nil
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
-	"gitlab.com/efronlicht/enve"
+	"github.com/runpod/rplog/internal/env"
+	"github.com/runpod/rplog/internal/id"
 )
 
 // Trace is a pair of IDs that can be used to trace a request through the system.
@@ -17,6 +18,9 @@ type Trace struct {
 	TraceID, RequestID         string    // unique identifiers for the trace and request. requests are unique to a trace.
 	TraceSource, RequestSource string    // the service that generated this trace or request
 	TraceStart, RequestStart   time.Time // the time the trace was created and the time the request was received
+	PrevTraceID                string    // the trace this one was started from via Restart, if any.
+	Variant                    string    // the deployment variant (e.g, "canary") the edge routed this trace to, if any. Propagated across hops.
+	ProcessingStart            time.Time // the time the request began processing after waiting for a slot, if it did: see StartProcessing. Not propagated.
 }
 
 // like http.ServeFunc, but for clients instead of servers.
@@ -34,21 +38,77 @@ func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { retu
 //
 // This middleware should be the first one executed in the chain, so that the Trace is available to all subsequent middlewares and handlers.
 // Note that directly applied middlewares execute in Last-In, First-Out order, so this middleware should be the last one applied.
-func ClientMiddleware(rt http.RoundTripper) http.RoundTripper {
+//
+// Headers other than the Trace's can be propagated from the inbound request: see ForwardHeaders.
+func ClientMiddleware(rt http.RoundTripper, opts ...Option) http.RoundTripper {
+	o := newOptions(opts)
 	return roundTripFunc(func(r *http.Request) (*http.Response, error) {
 		// check if the request already has a trace. If not, create a new one.
 		t, ok := FromCtx(r.Context())
+		var parentID string
 		if !ok {
 			t = New()
 		} else { // make a new request ID for this sub-request before shoving it across the wire
-			t.RequestID = newuuid()
+			parentID, t.RequestID = t.RequestID, NewID()
 		}
 		SaveToHeader(r.Header, t)
+		if o.prop == B3 {
+			SaveToHeaderB3(r.Header, t)
+			if ok {
+				r.Header.Set("X-B3-ParentSpanId", lastHex(parentID, 16))
+			}
+		}
+		if inbound, ok := r.Context().Value(ctxKey[http.Header]{}).(http.Header); ok {
+			for _, k := range o.forward {
+				if r.Header.Get(k) == "" && inbound.Get(k) != "" {
+					r.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), inbound.Values(k)...)
+				}
+			}
+		}
+		if lvl, ok := LevelFromCtx(r.Context()); ok {
+			r.Header.Set("X-Trace-Level", lvl.String())
+		}
+		// only an attempt set via WithAttempt: the inbound request's attempt (see inboundAttempt) is not this call's.
+		if n, ok := r.Context().Value(ctxKey[attempt]{}).(attempt); ok {
+			r.Header.Set("X-Request-Attempt", strconv.Itoa(int(n)))
+		}
 		r = r.WithContext(CtxWith(r.Context(), t))
-		return rt.RoundTrip(r)
+		c, ok := r.Context().Value(ctxKey[*calls]{}).(*calls)
+		if !ok {
+			return rt.RoundTrip(r)
+		}
+		start := time.Now()
+		resp, err := rt.RoundTrip(r)
+		call := Call{Service: r.URL.Host, ElapsedMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			call.Err = err.Error()
+		} else {
+			call.Status = resp.StatusCode
+		}
+		c.add(call)
+		return resp, err
 	})
 }
 
+// NewClient returns a copy of base (or of a zero http.Client, if it's nil) whose Transport is wrapped with ClientMiddleware and the given options,
+// keeping its timeout and other settings. Unlike replacing http.DefaultClient.Transport, it doesn't touch any globals, so libraries can use it safely.
+// A nil Transport is treated as http.DefaultTransport, as usual.
+func NewClient(base *http.Client, opts ...Option) *http.Client {
+	var c http.Client
+	if base != nil {
+		c = *base
+	}
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	c.Transport = ClientMiddleware(rt, opts...)
+	return &c
+}
+
+// DefaultClient returns a new trace-propagating client with the default settings: NewClient(nil).
+func DefaultClient() *http.Client { return NewClient(nil) }
+
 // ServerMiddleware adds a Trace to the request's context before passing it to the next handler.
 // This middleware should be the first one in the chain, so that the Trace is available to all subsequent middlewares and handlers.
 // Note that directly applied middlewares execute in First-In, First-Out order, so this middleware should be the first one applied.
@@ -56,22 +116,58 @@ func ClientMiddleware(rt http.RoundTripper) http.RoundTripper {
 //
 //	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("Hello, world!")) })
 //	http.ListenAndServe(":8080", trace.ServerMiddleware(h))
-func ServerMiddleware(next http.Handler) http.Handler {
+//
+// The TraceSource, RequestSource, and X-Trace-Level are only taken from requests from trusted networks: see WithTrustedNetworks.
+// If the request made any downstream calls via ClientMiddleware, an INFO record summarizing them, "request completed" (see DownstreamCalls), is logged when it completes,
+// unless another middleware already logged them, as rplog.Consolidate does: see MarkDownstreamCallsLogged.
+func ServerMiddleware(next http.Handler, opts ...Option) http.Handler {
+	return serverMiddleware(next, FromHeaderOrNew, opts)
+}
+
+// serverMiddleware is ServerMiddleware, reading the Trace from the request's headers with fromHeader.
+func serverMiddleware(next http.Handler, fromHeader func(http.Header) Trace, opts []Option) http.Handler {
+	o := newOptions(opts)
+	if o.prop == B3 {
+		native := fromHeader
+		fromHeader = func(h http.Header) Trace { return fromHeaderB3(h, native) }
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		t := FromHeaderOrNew(r.Header)
+		t := fromHeader(r.Header)
+		if !o.trustedSource(r) {
+			t.TraceSource, t.RequestSource = "", ""
+		}
 		ctx := CtxWith(r.Context(), t)
+		ctx = WithRequestInfo(ctx, RequestInfo{Method: r.Method, Path: r.URL.Path})
+		ctx = context.WithValue(ctx, ctxKey[http.Header]{}, r.Header) // for ForwardHeaders.
+		c := &calls{}
+		ctx = context.WithValue(ctx, ctxKey[*calls]{}, c)
+		if lvl, ok := levelFromHeader(r.Header); ok && o.trustedSource(r) {
+			ctx = WithLevel(ctx, lvl)
+		}
+		if n, err := strconv.Atoi(r.Header.Get("X-Request-Attempt")); err == nil && n > 0 {
+			ctx = context.WithValue(ctx, ctxKey[inboundAttempt]{}, inboundAttempt(n))
+		}
+		if ids := externalIDs(r.Header, o.extIDs); len(ids) > 0 {
+			ctx = context.WithValue(ctx, ctxKey[extIDs]{}, ids)
+		}
+		if o.sampling {
+			ctx = context.WithValue(ctx, ctxKey[sampled]{}, sampled(o.keep(t.TraceID)))
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
+		if list, dropped := c.unlogged(); len(list) > 0 {
+			slog.InfoContext(ctx, "request completed", slog.Any("downstream_calls", list), slog.Int("downstream_calls_dropped", dropped))
+		}
 	})
 }
 
-var thisServiceName = enve.StringOr("RUNPOD_SERVICE_NAME", "unknown")
+var thisServiceName = env.StringOr("RUNPOD_SERVICE_NAME", "unknown")
 
 // New returns a new Trace with a new TraceID and RequestID and the current time as the TraceStart and RequestStart.
 func New() Trace {
 	now := time.Now().UTC()
 	return Trace{
-		TraceID:       newuuid(),
-		RequestID:     newuuid(),
+		TraceID:       NewID(),
+		RequestID:     NewID(),
 		TraceSource:   thisServiceName,
 		RequestSource: thisServiceName,
 		TraceStart:    now,
@@ -93,6 +189,131 @@ func FromCtx(ctx context.Context) (t Trace, ok bool) {
 	return t, ok
 }
 
+// WithLevel returns a child context in which logs at or above lvl are emitted, even if the configured log level is higher.
+// It only ever lowers the threshold: records the configured level allows are still emitted, as are errors, whatever lvl is.
+// The level is propagated across service boundaries via the X-Trace-Level header by ClientMiddleware and ServerMiddleware,
+// so a single flagged trace can capture full debug detail end-to-end. ServerMiddleware only honors the header from trusted networks: see WithTrustedNetworks.
+func WithLevel(ctx context.Context, lvl slog.Level) context.Context {
+	return context.WithValue(ctx, ctxKey[slog.Level]{}, lvl)
+}
+
+// LevelFromCtx returns the minimum log level set by WithLevel, if it exists.
+func LevelFromCtx(ctx context.Context) (lvl slog.Level, ok bool) {
+	lvl, ok = ctx.Value(ctxKey[slog.Level]{}).(slog.Level)
+	return lvl, ok
+}
+
+// levelFromHeader parses the X-Trace-Level header, if it exists. Malformed levels are ignored.
+func levelFromHeader(h http.Header) (lvl slog.Level, ok bool) {
+	v := h.Get("X-Trace-Level")
+	if v == "" {
+		return lvl, false
+	}
+	if err := lvl.UnmarshalText([]byte(v)); err != nil {
+		slog.Warn("ignoring malformed X-Trace-Level header", slog.String("level", v), slog.String("err", err.Error()))
+		return lvl, false
+	}
+	return lvl, true
+}
+
+// operation is the name of the operation in progress, as set by WithOperation.
+type operation string
+
+// extIDs are the correlation IDs of external systems, by header name: see WithExternalIDs.
+type extIDs map[string]string
+
+func externalIDs(h http.Header, headers []string) extIDs {
+	var ids extIDs
+	for _, k := range headers {
+		if v := validID(k, h.Get(k)); v != "" {
+			if ids == nil {
+				ids = make(extIDs, len(headers))
+			}
+			ids[k] = v
+		}
+	}
+	return ids
+}
+
+// ExternalIDsFromCtx returns the external correlation IDs captured by ServerMiddleware (see WithExternalIDs), by header name, if there are any.
+// The map must not be modified.
+func ExternalIDsFromCtx(ctx context.Context) (ids map[string]string, ok bool) {
+	ids, ok = ctx.Value(ctxKey[extIDs]{}).(extIDs)
+	return ids, ok
+}
+
+// attempt numbers the attempts at a request, counting from 1: see WithAttempt.
+type attempt int
+
+// inboundAttempt is the attempt number ServerMiddleware read from the X-Request-Attempt header. It's only logged:
+// unlike an attempt, ClientMiddleware doesn't send it on, or every call the handler makes would look like a retry downstream.
+type inboundAttempt int
+
+// WithAttempt returns a child context recording that a request made with it is attempt n (counting from 1) at the same request,
+// for a client that retries: ClientMiddleware sends it as the X-Request-Attempt header, ServerMiddleware reads it back,
+// and the rplog Handler logs it as `request_attempt`, so that retry-amplified load can be told apart from first attempts.
+//
+// Example Usage:
+//
+//	for n := 1; n <= 3; n++ {
+//		req, _ := http.NewRequestWithContext(trace.WithAttempt(ctx, n), "GET", url, nil)
+//		if resp, err = client.Do(req); err == nil {
+//			break
+//		}
+//	}
+func WithAttempt(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, ctxKey[attempt]{}, attempt(n))
+}
+
+// AttemptFromCtx returns the attempt number set by WithAttempt or, failing that, by ServerMiddleware from the X-Request-Attempt header, if it exists.
+func AttemptFromCtx(ctx context.Context) (n int, ok bool) {
+	if a, ok := ctx.Value(ctxKey[attempt]{}).(attempt); ok {
+		return int(a), true
+	}
+	a, ok := ctx.Value(ctxKey[inboundAttempt]{}).(inboundAttempt)
+	return int(a), ok
+}
+
+// sampled is the decision made by ServerMiddleware's sampling: see WithSampleRate.
+type sampled bool
+
+// SampledFromCtx returns whether the trace in the context was sampled in (keep) or out by ServerMiddleware; ok is false if it wasn't sampled at all.
+// The rplog Handler drops all but the errors of a trace that was sampled out.
+func SampledFromCtx(ctx context.Context) (keep, ok bool) {
+	s, ok := ctx.Value(ctxKey[sampled]{}).(sampled)
+	return bool(s), ok
+}
+
+// WithOperation returns a child context naming the operation in progress (e.g, a route pattern or a span name).
+// The rplog Handler attaches it to every log within that context as the `operation` attribute.
+func WithOperation(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKey[operation]{}, operation(name))
+}
+
+// OperationFromCtx returns the operation name set by WithOperation, if it exists.
+func OperationFromCtx(ctx context.Context) (name string, ok bool) {
+	op, ok := ctx.Value(ctxKey[operation]{}).(operation)
+	return string(op), ok
+}
+
+// RequestInfo describes the HTTP request being served. ServerMiddleware stores the Method and Path;
+// routers that know the matched route pattern can store it as well, via WithRequestInfo.
+// The rplog Handler attaches it to every log within the request as the `http` group.
+type RequestInfo struct {
+	Method, Path, Route string
+}
+
+// WithRequestInfo returns a child context describing the HTTP request being served.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, ctxKey[RequestInfo]{}, info)
+}
+
+// RequestInfoFromCtx returns the RequestInfo set by WithRequestInfo, if it exists.
+func RequestInfoFromCtx(ctx context.Context) (info RequestInfo, ok bool) {
+	info, ok = ctx.Value(ctxKey[RequestInfo]{}).(RequestInfo)
+	return info, ok
+}
+
 // / FromCtxOrNew returns the Trace from the given context, if it exists, and creates a new one if it doesn't.
 func FromCtxOrNew(ctx context.Context) Trace {
 	t, ok := FromCtx(ctx)
@@ -102,6 +323,36 @@ func FromCtxOrNew(ctx context.Context) Trace {
 	return t
 }
 
+// StartProcessing returns a context whose Trace records that the request begins processing now, having waited for a slot
+// (e.g, of a semaphore-limited handler) since its RequestStart. The rplog Handler then logs the wait as request_queue_ms and the time since as request_processing_ms,
+// separating "slow because overloaded" from "slow because the work is slow".
+// If there's no Trace in ctx, it returns ctx unchanged.
+//
+// Example Usage:
+//
+//	sem <- struct{}{}
+//	defer func() { <-sem }()
+//	ctx := trace.StartProcessing(r.Context())
+func StartProcessing(ctx context.Context) context.Context {
+	t, ok := FromCtx(ctx)
+	if !ok {
+		return ctx
+	}
+	t.ProcessingStart = time.Now().UTC()
+	return CtxWith(ctx, t)
+}
+
+// Restart returns a child context holding a fresh trace generation: a new TraceID and RequestID, with TraceStart and RequestStart reset to now.
+// The previous TraceID (if the context had a Trace) is kept as PrevTraceID, leaving a breadcrumb from one generation to the next.
+// Use it for long-running, phased jobs (e.g, each stage of a multi-stage pipeline) so that elapsed times stay meaningful.
+func Restart(ctx context.Context) context.Context {
+	t := New()
+	if prev, ok := FromCtx(ctx); ok {
+		t.PrevTraceID = prev.TraceID
+	}
+	return CtxWith(ctx, t)
+}
+
 // Save a Trace into the given header, over-writing the X-Trace-ID, X-Request-ID, and X-Trace-Start headers.
 // Note that there is no RequestStart header: the request timing starts when the server receives the request.
 // This is in contrast to the TraceStart header, which is the time the trace was created and persists across service boundaries.
@@ -111,25 +362,50 @@ func SaveToHeader(h http.Header, t Trace) {
 	h.Set("X-Trace-Start", t.TraceStart.Format(time.RFC3339))
 	h.Set("X-Trace-Source", t.TraceSource)
 	h.Set("X-Request-Source", t.RequestSource)
+	if t.PrevTraceID != "" {
+		h.Set("X-Prev-Trace-ID", t.PrevTraceID)
+	}
+	if t.Variant != "" {
+		h.Set("X-Trace-Variant", t.Variant)
+	}
+	if emitXRay {
+		h.Set("X-Amzn-Trace-Id", t.ToXRay().String())
+	}
 }
 
-// uuid generates a new UUID, preferring V7 over V4, but falling back to V4 if V7 is not available.
-func newuuid() string {
-	u, err := uuid.NewV7()
-	if err != nil {
-		u = uuid.New()
+// NewID generates a new unique ID for a trace, request, log record, or instance: a UUID, preferring V7 over V4, but falling back to V4 if V7 is not available
+// (or always V4, when built with the rplog_nodeps tag).
+// If RUNPOD_ID_FORMAT is "ulid", it generates a ULID instead.
+func NewID() string {
+	if idFormat == "ulid" {
+		return newULID(time.Now())
 	}
-	return u.String()
+	return id.New().String()
 }
 
 // FromHeaderOrNew returns a Trace from the given header, if it exists, and creates a new one if it doesn't.
+// X-Trace-Start is only honored along with an inherited TraceID: a fresh trace always starts now.
+// If there's no X-Trace-ID header, the Root of a valid X-Amzn-Trace-Id (AWS X-Ray) header is used as the TraceID instead,
+// and its epoch as the TraceStart (unless X-Trace-Start is present).
 func FromHeaderOrNew(h http.Header) Trace {
 	now := time.Now().UTC()
 
+	traceID := validID("X-Trace-ID", h.Get("X-Trace-ID"))
+	var xrayStart time.Time
+	if traceID == "" && h.Get("X-Amzn-Trace-Id") != "" {
+		if x, err := ParseXRay(h.Get("X-Amzn-Trace-Id")); err == nil {
+			traceID = x.Root
+			xrayStart, _ = x.Start()
+		}
+	}
+
 	var traceStart time.Time
 	var err error
-	if traceStart, err = time.Parse(time.RFC3339, h.Get("X-Trace-Start")); err != nil {
-		traceStart = now
+	if traceID == "" {
+		// a genuinely new trace: honoring an inherited X-Trace-Start would only inflate trace_elapsed_ms.
+		traceID, traceStart = NewID(), now
+	} else if traceStart, err = time.Parse(time.RFC3339, h.Get("X-Trace-Start")); err != nil {
+		traceStart = orelse(xrayStart, func() time.Time { return now })
 	}
 
 	if traceStart.After(now) {
@@ -138,13 +414,59 @@ func FromHeaderOrNew(h http.Header) Trace {
 	}
 
 	return Trace{
-		TraceID:       orelse(h.Get("X-Trace-ID"), newuuid),
-		RequestID:     orelse(h.Get("X-Request-ID"), newuuid),
+		TraceID:       traceID,
+		RequestID:     orelse(validID("X-Request-ID", h.Get("X-Request-ID")), NewID),
 		TraceStart:    traceStart,
 		RequestStart:  now,
 		TraceSource:   h.Get("X-Trace-Source"),
 		RequestSource: h.Get("X-Request-Source"),
+		PrevTraceID:   validID("X-Prev-Trace-ID", h.Get("X-Prev-Trace-ID")),
+		Variant:       validID("X-Trace-Variant", h.Get("X-Trace-Variant")),
+	}
+}
+
+// traceHeaders are the headers SaveToHeader uses to carry a Trace across service boundaries.
+var traceHeaders = [...]string{"X-Trace-ID", "X-Request-ID", "X-Trace-Start", "X-Trace-Source", "X-Request-Source", "X-Prev-Trace-ID", "X-Trace-Variant", "X-Amzn-Trace-Id"}
+
+// FromRequestOrNew is like FromHeaderOrNew, but falls back to the request's trailers for any trace header missing from the leading headers,
+// as sent by some clients (notably gRPC-Web). Leading headers always take precedence over trailers.
+//
+// Per HTTP semantics, r.Trailer is only populated once the request body has been read to EOF:
+// call this after consuming the body, or the trailers will be silently ignored.
+func FromRequestOrNew(r *http.Request) Trace {
+	if len(r.Trailer) == 0 {
+		return FromHeaderOrNew(r.Header)
+	}
+	h := r.Header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	for _, k := range traceHeaders {
+		if h.Get(k) == "" && r.Trailer.Get(k) != "" {
+			h.Set(k, r.Trailer.Get(k))
+		}
+	}
+	return FromHeaderOrNew(h)
+}
+
+// maxIDLen is the maximum length of a trace or request ID accepted from a header.
+const maxIDLen = 128
+
+// validID returns id if it's safe to put on every log line: at most maxIDLen visible ASCII characters.
+// Otherwise, it logs a warning and returns the empty string, so that the caller mints a fresh ID instead.
+// IDs come from untrusted clients: without this, a client could bloat or forge the logs of every request it makes.
+func validID(header, id string) string {
+	if len(id) > maxIDLen {
+		slog.Warn("ignoring oversized trace header", slog.String("header", header), slog.Int("len", len(id)))
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			slog.Warn("ignoring trace header with invalid characters", slog.String("header", header), slog.Int("len", len(id)))
+			return ""
+		}
 	}
+	return id
 }
 
 // return a if it's non-zero, otherwise call f and return its result.
@@ -0,0 +1,251 @@
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromHeaderOrNewValidatesIDs(t *testing.T) {
+	for _, tt := range []struct {
+		name, id string
+		keep     bool
+	}{
+		{"uuid", "01890a5d-ac96-774b-bcce-b302099a8057", true},
+		{"max length", strings.Repeat("a", maxIDLen), true},
+		{"too long", strings.Repeat("a", maxIDLen+1), false},
+		{"space", "a b", false},
+		{"newline", "a\n{\"level\":\"ERROR\"}", false},
+		{"non-ascii", "ñ", false},
+	} {
+		h := make(http.Header)
+		h.Set("X-Trace-ID", tt.id)
+		h.Set("X-Request-ID", tt.id)
+		h.Set("X-Trace-Variant", tt.id)
+		got := FromHeaderOrNew(h)
+		if kept := got.TraceID == tt.id; kept != tt.keep {
+			t.Errorf("%s: TraceID kept = %v, want %v", tt.name, kept, tt.keep)
+		}
+		if kept := got.RequestID == tt.id; kept != tt.keep {
+			t.Errorf("%s: RequestID kept = %v, want %v", tt.name, kept, tt.keep)
+		}
+		if kept := got.Variant == tt.id; kept != tt.keep {
+			t.Errorf("%s: Variant kept = %v, want %v", tt.name, kept, tt.keep)
+		}
+		if got.TraceID == "" || got.RequestID == "" {
+			t.Errorf("%s: invalid IDs should be replaced, not emptied", tt.name)
+		}
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	want := New()
+	got, err := ParseTraceToken(want.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID != want.TraceID || got.RequestID != want.RequestID || got.TraceSource != want.TraceSource {
+		t.Errorf("ParseTraceToken(Token()) = %+v, want IDs and source of %+v", got, want)
+	}
+	for _, bad := range []string{"", "abc", "2." + want.Token()[2:], "1.!!!", "1." + base64URL("only\none")} {
+		if _, err := ParseTraceToken(bad); err == nil {
+			t.Errorf("ParseTraceToken(%q): expected an error", bad)
+		}
+	}
+}
+
+func base64URL(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+func TestFromHeaderOrNewFreshTraceStartsNow(t *testing.T) {
+	stale := time.Now().Add(-3 * time.Hour).UTC().Format(time.RFC3339)
+	h := make(http.Header)
+	h.Set("X-Trace-Start", stale)
+	if got := FromHeaderOrNew(h); time.Since(got.TraceStart) > time.Minute {
+		t.Errorf("fresh trace inherited stale start %v", got.TraceStart)
+	}
+	h.Set("X-Trace-ID", "inherited")
+	if got := FromHeaderOrNew(h); got.TraceStart.Format(time.RFC3339) != stale {
+		t.Errorf("inherited trace: TraceStart = %v, want %v", got.TraceStart, stale)
+	}
+}
+
+func TestOTelIDs(t *testing.T) {
+	want := New()
+	traceID, spanID := want.OTelIDs()
+	got := FromOTelIDs(traceID, spanID)
+	if got.TraceID != want.TraceID {
+		t.Errorf("FromOTelIDs(OTelIDs()).TraceID = %q, want %q", got.TraceID, want.TraceID)
+	}
+	if !strings.HasSuffix(strings.ReplaceAll(want.RequestID, "-", ""), got.RequestID) {
+		t.Errorf("span ID %s is not the tail of the RequestID %s", got.RequestID, want.RequestID)
+	}
+}
+
+func TestULID(t *testing.T) {
+	// from the spec: the timestamp 1469918176385 encodes as 01ARYZ6S41.
+	if got := newULID(time.UnixMilli(1469918176385))[:10]; got != "01ARYZ6S41" {
+		t.Errorf("newULID timestamp = %s, want 01ARYZ6S41", got)
+	}
+	if a, b := newULID(time.UnixMilli(1)), newULID(time.UnixMilli(2)); len(a) != 26 || a >= b {
+		t.Errorf("newULID: %s, %s: want 26 characters, sorted by time", a, b)
+	}
+}
+
+func TestServerMiddlewareTrustedSource(t *testing.T) {
+	var got Trace
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got, _ = FromCtx(r.Context()) })
+	trusted := ServerMiddleware(h, WithTrustedNetworks(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")))
+	for _, tt := range []struct {
+		h          http.Handler
+		remoteAddr string
+		want       string
+	}{
+		{ServerMiddleware(h), "10.1.2.3:4567", ""},
+		{trusted, "10.1.2.3:4567", "billing"},
+		{trusted, "[::ffff:10.1.2.3]:4567", "billing"},
+		{trusted, "[fd12::1]:4567", "billing"},
+		{trusted, "203.0.113.9:4567", ""},
+		{trusted, "[2001:db8::1]:4567", ""},
+		{trusted, "10.1.2.3", ""}, // no port: unparseable, so untrusted.
+		{trusted, "", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Trace-Source", "billing")
+		r.Header.Set("X-Request-Source", "billing")
+		tt.h.ServeHTTP(httptest.NewRecorder(), r)
+		if got.TraceSource != tt.want || got.RequestSource != tt.want {
+			t.Errorf("from %q: TraceSource, RequestSource = %q, %q, want %q", tt.remoteAddr, got.TraceSource, got.RequestSource, tt.want)
+		}
+	}
+}
+
+func TestWithSampleRate(t *testing.T) {
+	for _, tt := range []struct {
+		rate     float64
+		min, max int // of 1000 traces kept.
+	}{
+		{0.25, 200, 300},
+		{1, 1000, 1000},
+		{2, 1000, 1000},
+		{0, 0, 0},
+		{-1, 0, 0},
+	} {
+		o := newOptions([]Option{WithSampleRate(tt.rate)})
+		kept := 0
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprintf("trace-%d", i)
+			if o.keep(id) != o.keep(id) {
+				t.Fatalf("rate %v: keep(%s) is not deterministic", tt.rate, id)
+			}
+			if o.keep(id) {
+				kept++
+			}
+		}
+		if kept < tt.min || kept > tt.max {
+			t.Errorf("rate %v: kept %d of 1000 traces, want %d to %d", tt.rate, kept, tt.min, tt.max)
+		}
+	}
+
+	var keep, ok bool
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { keep, ok = SampledFromCtx(r.Context()) })
+	ServerMiddleware(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if ok {
+		t.Errorf("without WithSampleRate: SampledFromCtx ok = true, want false")
+	}
+	ServerMiddleware(h, WithSampleRate(0)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !ok || keep {
+		t.Errorf("WithSampleRate(0): SampledFromCtx = %v, %v, want sampled out", keep, ok)
+	}
+}
+
+func TestFromRequestOrNewTrailers(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nHost: x\r\nX-Request-ID: from-header\r\nTrailer: X-Trace-ID, X-Request-ID\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"2\r\nhi\r\n0\r\nX-Trace-ID: from-trailer\r\nX-Request-ID: overridden\r\n\r\n"
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FromRequestOrNew(r); got.TraceID == "from-trailer" {
+		t.Errorf("trailers were used before the body was read")
+	}
+	if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		t.Fatal(err)
+	}
+	got := FromRequestOrNew(r)
+	if got.TraceID != "from-trailer" || got.RequestID != "from-header" {
+		t.Errorf("FromRequestOrNew: TraceID, RequestID = %q, %q, want from-trailer, from-header", got.TraceID, got.RequestID)
+	}
+}
+
+// the attempt a server was called with is its own: it must not be passed on to the calls it makes.
+func TestAttemptNotForwarded(t *testing.T) {
+	var got []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Request-Attempt"))
+	}))
+	defer backend.Close()
+	client := NewClient(nil)
+	var inbound int
+	front := ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inbound, _ = AttemptFromCtx(r.Context())
+		for _, ctx := range []context.Context{r.Context(), WithAttempt(r.Context(), 2)} {
+			req, _ := http.NewRequestWithContext(ctx, "GET", backend.URL, nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Attempt", "3")
+	front.ServeHTTP(httptest.NewRecorder(), r)
+
+	if inbound != 3 {
+		t.Errorf("AttemptFromCtx in the server = %d, want 3", inbound)
+	}
+	if len(got) != 2 || got[0] != "" || got[1] != "2" {
+		t.Errorf("backend got X-Request-Attempt %q, want none, then 2", got)
+	}
+}
+
+func TestForwardHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.Header }))
+	defer backend.Close()
+	client := NewClient(nil, ForwardHeaders("X-Tenant-ID", "accept-language"))
+	front := ServerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", backend.URL, nil)
+		req.Header.Set("Accept-Language", "fr") // set by the caller: wins over the inbound request's.
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Add("X-Tenant-ID", "t1")
+	r.Header.Add("X-Tenant-ID", "t2")
+	r.Header.Set("Accept-Language", "en")
+	r.Header.Set("Authorization", "Bearer secret")
+	front.ServeHTTP(httptest.NewRecorder(), r)
+
+	if v := got.Values("X-Tenant-ID"); len(v) != 2 || v[0] != "t1" || v[1] != "t2" {
+		t.Errorf("X-Tenant-ID = %q, want the inbound request's values", v)
+	}
+	if v := got.Get("Accept-Language"); v != "fr" {
+		t.Errorf("Accept-Language = %q, want fr, as set on the outbound request", v)
+	}
+	if v := got.Get("Authorization"); v != "" {
+		t.Errorf("Authorization = %q: forwarded without being listed", v)
+	}
+}
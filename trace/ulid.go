@@ -0,0 +1,32 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// idFormat selects the format of NewID: "uuid" (UUIDv7) or "ulid".
+var idFormat = env.StringOr("RUNPOD_ID_FORMAT", "uuid")
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID (https://github.com/ulid/spec): 26 characters of Crockford base32 encoding a 48-bit millisecond timestamp followed by 80 random bits.
+// Like a UUIDv7, it sorts by creation time.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+	// 128 bits in 26 characters of 5 bits: the first character carries only the top 3 bits.
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context (https://www.w3.org/TR/trace-context/) support, for interop with Envoy, OpenTelemetry collectors,
+// and third-party APIs that propagate traces via the traceparent header rather than X-Trace-ID and X-Request-ID.
+// The TraceID and RequestID map onto the trace-id and parent-id as in Trace.OTelIDs.
+// The tracestate header is neither read nor written: vendor-specific state isn't carried by a Trace.
+
+// SaveToHeaderW3C writes the Trace to h as a W3C traceparent header, "00-{trace-id}-{parent-id}-01", as a sampled trace. See Trace.OTelIDs for the mapping.
+// Unlike SaveToHeader, it writes none of the X-Trace-* headers.
+func SaveToHeaderW3C(h http.Header, t Trace) {
+	traceID, spanID := t.OTelIDs()
+	h.Set("traceparent", "00-"+hex.EncodeToString(traceID[:])+"-"+hex.EncodeToString(spanID[:])+"-01")
+}
+
+// FromHeaderW3C returns a Trace from the W3C traceparent header in h: the trace-id as the TraceID and the parent-id as the RequestID, as in FromOTelIDs,
+// with the other fields as in New. If the header is missing or malformed, it returns a new Trace instead.
+func FromHeaderW3C(h http.Header) Trace {
+	traceID, spanID, err := parseTraceparent(h.Get("traceparent"))
+	if err != nil {
+		return New()
+	}
+	return FromOTelIDs(traceID, spanID)
+}
+
+// ServerMiddlewareW3C is like ServerMiddleware, but reads the Trace from the W3C traceparent header (see FromHeaderW3C) if the request has one,
+// falling back to the X-Trace-* headers (see FromHeaderOrNew) otherwise.
+func ServerMiddlewareW3C(next http.Handler, opts ...Option) http.Handler {
+	return serverMiddleware(next, func(h http.Header) Trace {
+		if h.Get("traceparent") == "" {
+			return FromHeaderOrNew(h)
+		}
+		return FromHeaderW3C(h)
+	}, opts)
+}
+
+// parseTraceparent parses a traceparent header: {version}-{trace-id}-{parent-id}-{trace-flags}, all lowercase hex.
+// Per the spec, versions past 00 may append fields, which are ignored; version ff, and all-zero IDs, are invalid.
+func parseTraceparent(s string) (traceID [16]byte, spanID [8]byte, err error) {
+	fields := strings.Split(s, "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return traceID, spanID, errors.New("traceparent: malformed")
+	}
+	for _, f := range fields[:4] {
+		if !isLowerHex(f) {
+			return traceID, spanID, errors.New("traceparent: not lowercase hex")
+		}
+	}
+	switch {
+	case fields[0] == "ff":
+		return traceID, spanID, errors.New("traceparent: invalid version ff")
+	case fields[0] == "00" && len(fields) != 4:
+		return traceID, spanID, errors.New("traceparent: extra fields in version 00")
+	case strings.Trim(fields[1], "0") == "" || strings.Trim(fields[2], "0") == "":
+		return traceID, spanID, errors.New("traceparent: all-zero ID")
+	}
+	hex.Decode(traceID[:], []byte(fields[1]))
+	hex.Decode(spanID[:], []byte(fields[2]))
+	return traceID, spanID, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tt := range []struct {
+		in string
+		ok bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future", true}, // later versions may add fields
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false}, // version 00 may not
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},       // invalid version
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},        // short trace-id
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-01", false},        // short parent-id
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},       // uppercase
+		{"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01", false},       // non-hex
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},       // zero trace-id
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},       // zero parent-id
+	} {
+		if _, _, err := parseTraceparent(tt.in); (err == nil) != tt.ok {
+			t.Errorf("parseTraceparent(%q): got err %v, want ok=%v", tt.in, err, tt.ok)
+		}
+	}
+}
+
+func TestW3CRoundTrip(t *testing.T) {
+	want := New()
+	h := make(http.Header)
+	SaveToHeaderW3C(h, want)
+	if got := FromHeaderW3C(h); got.TraceID != want.TraceID {
+		t.Errorf("FromHeaderW3C(SaveToHeaderW3C()).TraceID = %q, want %q (traceparent %q)", got.TraceID, want.TraceID, h.Get("traceparent"))
+	}
+
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got := FromHeaderW3C(h); got.TraceID != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" || got.RequestID != "00f067aa0ba902b7" {
+		t.Errorf("FromHeaderW3C: got IDs %q, %q", got.TraceID, got.RequestID)
+	}
+	h.Set("traceparent", "garbage")
+	if got := FromHeaderW3C(h); got.TraceID == "" || got.TraceID == "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+		t.Errorf("FromHeaderW3C(malformed): got TraceID %q, want a fresh one", got.TraceID)
+	}
+}
+
+func TestServerMiddlewareW3C(t *testing.T) {
+	var got Trace
+	h := ServerMiddlewareW3C(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got, _ = FromCtx(r.Context()) }))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.TraceID != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+		t.Errorf("TraceID = %q, want it from traceparent", got.TraceID)
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Trace-ID", "from-x-trace-id")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.TraceID != "from-x-trace-id" {
+		t.Errorf("TraceID = %q, want it from X-Trace-ID", got.TraceID)
+	}
+}
@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runpod/rplog/internal/env"
+)
+
+// emitXRay controls whether SaveToHeader also writes the X-Amzn-Trace-Id header.
+var emitXRay = env.BoolOr("RUNPOD_TRACE_XRAY", false)
+
+// XRay is a parsed AWS X-Ray trace header, as found in X-Amzn-Trace-Id. See
+// https://docs.aws.amazon.com/xray/latest/devguide/xray-concepts.html#xray-concepts-tracingheader
+//
+//	X-Amzn-Trace-Id: Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1
+type XRay struct {
+	Root    string // 1-{8 hex digits: epoch seconds}-{24 hex digits}. Mandatory.
+	Parent  string // 16 hex digits identifying the parent segment. Optional.
+	Sampled string // "0", "1", or "?". Optional.
+}
+
+// ParseXRay parses the value of an X-Amzn-Trace-Id header.
+// Fields other than Root, Parent, and Sampled (e.g, Self or Lineage) are ignored, as are empty fields.
+func ParseXRay(s string) (XRay, error) {
+	var x XRay
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return XRay{}, fmt.Errorf("xray: malformed field %q: missing '='", field)
+		}
+		switch k {
+		case "Root":
+			if !validXRayRoot(v) {
+				return XRay{}, fmt.Errorf("xray: malformed Root %q", v)
+			}
+			x.Root = v
+		case "Parent":
+			if len(v) != 16 || !isHex(v) {
+				return XRay{}, fmt.Errorf("xray: malformed Parent %q", v)
+			}
+			x.Parent = v
+		case "Sampled":
+			if v != "0" && v != "1" && v != "?" {
+				return XRay{}, fmt.Errorf("xray: malformed Sampled %q", v)
+			}
+			x.Sampled = v
+		}
+	}
+	if x.Root == "" {
+		return XRay{}, errors.New("xray: missing Root")
+	}
+	return x, nil
+}
+
+// String formats x as the value of an X-Amzn-Trace-Id header, omitting empty optional fields.
+func (x XRay) String() string {
+	s := "Root=" + x.Root
+	if x.Parent != "" {
+		s += ";Parent=" + x.Parent
+	}
+	if x.Sampled != "" {
+		s += ";Sampled=" + x.Sampled
+	}
+	return s
+}
+
+// Start returns the trace start time encoded in the Root's epoch field.
+func (x XRay) Start() (time.Time, bool) {
+	if !validXRayRoot(x.Root) {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(x.Root[2:10], 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0).UTC(), true
+}
+
+// ToXRay maps a Trace onto X-Ray's header format.
+//   - If the TraceID is already an X-Ray Root (i.e, it came in via X-Amzn-Trace-Id), it's used verbatim.
+//     Otherwise, the Root is built from the TraceStart's epoch seconds and the last 24 hex digits of the TraceID (or of its SHA-256, if the TraceID has too few hex digits).
+//   - The Parent is the last 16 hex digits of the RequestID, chosen the same way.
+//   - Sampled is left empty, deferring the sampling decision to X-Ray.
+func (t Trace) ToXRay() XRay {
+	root := t.TraceID
+	if !validXRayRoot(root) {
+		root = fmt.Sprintf("1-%08x-%s", uint32(t.TraceStart.Unix()), lastHex(t.TraceID, 24))
+	}
+	return XRay{Root: root, Parent: lastHex(t.RequestID, 16)}
+}
+
+// validXRayRoot reports whether s matches 1-{8 hex}-{24 hex}.
+func validXRayRoot(s string) bool {
+	return len(s) == 35 && s[:2] == "1-" && s[10] == '-' && isHex(s[2:10]) && isHex(s[11:])
+}
+
+// lastHex returns the last n hex digits of id (ignoring any other characters, like the dashes in a UUID),
+// falling back to the hex-encoded SHA-256 of id if it doesn't have enough.
+func lastHex(id string, n int) string {
+	digits := make([]byte, 0, len(id))
+	for i := 0; i < len(id); i++ {
+		if isHexDigit(id[i]) {
+			digits = append(digits, toLowerHex(id[i]))
+		}
+	}
+	if len(digits) < n {
+		sum := sha256.Sum256([]byte(id))
+		return hex.EncodeToString(sum[:])[:n]
+	}
+	return string(digits[len(digits)-n:])
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func toLowerHex(c byte) byte {
+	if 'A' <= c && c <= 'F' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
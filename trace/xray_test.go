@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseXRay(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want XRay
+		ok   bool
+	}{
+		{"Root=1-5759e988-bd862e3fe1be46a994272793", XRay{Root: "1-5759e988-bd862e3fe1be46a994272793"}, true},
+		{"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1", XRay{"1-5759e988-bd862e3fe1be46a994272793", "53995c3f42cd8ad8", "1"}, true},
+		{"Self=1-67891234-12456789abcdef012345678;Root=1-67891233-abcdef012345678912345678;CalledFrom=app", XRay{Root: "1-67891233-abcdef012345678912345678"}, true},
+		{"Root=1-5759e988-bd862e3fe1be46a994272793; Sampled=?;", XRay{Root: "1-5759e988-bd862e3fe1be46a994272793", Sampled: "?"}, true},
+		{"", XRay{}, false},
+		{"Parent=53995c3f42cd8ad8", XRay{}, false},                                  // missing root
+		{"Root=2-5759e988-bd862e3fe1be46a994272793", XRay{}, false},                 // bad version
+		{"Root=1-5759e988-bd862e3fe1be46a99427279", XRay{}, false},                  // short
+		{"Root=1-5759e98g-bd862e3fe1be46a994272793", XRay{}, false},                 // non-hex
+		{"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f", XRay{}, false}, // short parent
+		{"Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=yes", XRay{}, false},     // bad sampled
+		{"Root=1-5759e988-bd862e3fe1be46a994272793;Parent", XRay{}, false},          // missing '='
+	} {
+		got, err := ParseXRay(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseXRay(%q): got err %v, want ok=%v", tt.in, err, tt.ok)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseXRay(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestXRayRoundTrip(t *testing.T) {
+	const in = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+	x, err := ParseXRay(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := x.String(); got != in {
+		t.Errorf("String() = %q, want %q", got, in)
+	}
+	start, ok := x.Start()
+	if want := time.Unix(0x5759e988, 0).UTC(); !ok || !start.Equal(want) {
+		t.Errorf("Start() = %v, %v; want %v", start, ok, want)
+	}
+}
+
+func TestToXRay(t *testing.T) {
+	tr := Trace{
+		TraceID:    "01890a5d-ac96-774b-bcce-b302099a8057",
+		RequestID:  "01890a5d-ac96-774b-bcce-b302099a8058",
+		TraceStart: time.Unix(0x5759e988, 0),
+	}
+	x := tr.ToXRay()
+	if want := "1-5759e988-ac96774bbcceb302099a8057"; x.Root != want {
+		t.Errorf("Root = %q, want %q", x.Root, want)
+	}
+	if want := "bcceb302099a8058"; x.Parent != want {
+		t.Errorf("Parent = %q, want %q", x.Parent, want)
+	}
+	if _, err := ParseXRay(x.String()); err != nil {
+		t.Errorf("ToXRay produced an unparseable header %q: %v", x, err)
+	}
+	// non-hex IDs are hashed rather than rejected.
+	if _, err := ParseXRay(Trace{TraceID: "job", RequestID: "x"}.ToXRay().String()); err != nil {
+		t.Errorf("ToXRay with non-hex IDs: %v", err)
+	}
+}
+
+func TestFromHeaderOrNewXRay(t *testing.T) {
+	h := make(http.Header)
+	h.Set("X-Amzn-Trace-Id", "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8")
+	tr := FromHeaderOrNew(h)
+	if tr.TraceID != "1-5759e988-bd862e3fe1be46a994272793" {
+		t.Errorf("TraceID = %q, want the X-Ray root", tr.TraceID)
+	}
+	if !tr.TraceStart.Equal(time.Unix(0x5759e988, 0)) {
+		t.Errorf("TraceStart = %v, want the X-Ray epoch", tr.TraceStart)
+	}
+	h.Set("X-Trace-ID", "native")
+	if tr := FromHeaderOrNew(h); tr.TraceID != "native" {
+		t.Errorf("TraceID = %q: X-Trace-ID should take precedence over X-Amzn-Trace-Id", tr.TraceID)
+	}
+}
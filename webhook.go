@@ -0,0 +1,148 @@
+package rplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// InitWebhookAlerts additionally POSTs each record at or above minLevel to url as a JSON alert, for critical errors that shouldn't wait on log-based alerting.
+// Alerts are fingerprinted by message and service: after an alert is sent, records with the same fingerprint don't send another until dedupWindow has passed,
+// so an error loop can't cause an alert storm. Records are still logged as usual either way.
+//
+// Alerts are sent asynchronously (see Flush); a failure to send one is logged at WARN, but not retried.
+// Call it after Init (or InitProto): it has no effect on any other handler.
+//
+// The payload is an object with the fields fingerprint, service, env, instance_id, time, level, msg, and attrs (the record's other attributes, redacted).
+func InitWebhookAlerts(url string, minLevel slog.Level, dedupWindow time.Duration) {
+	h, ok := slog.Default().Handler().(*Handler)
+	if !ok {
+		return
+	}
+	m := h.meta
+	if m == nil {
+		m = &Metadata{}
+	}
+	h2 := *h
+	h2.Handler = &alertHandler{Handler: h.Handler, a: &alerter{
+		url:    url,
+		min:    minLevel,
+		window: dedupWindow,
+		meta:   m,
+		log:    h.Handler,
+		client: &http.Client{Timeout: 10 * time.Second},
+		sent:   make(map[string]time.Time),
+	}}
+	slog.SetDefault(slog.New(&h2))
+	health.alerts.Store(true)
+}
+
+// alertHandler passes records through to the wrapped handler, sending an alert for those at or above the alerter's level.
+type alertHandler struct {
+	slog.Handler
+	a *alerter // shared among handlers derived via WithAttrs and WithGroup
+}
+
+type alerter struct {
+	url    string
+	min    slog.Level
+	window time.Duration
+	meta   *Metadata
+	log    slog.Handler // reports failures to send: not wrapped, so a failure can't alert in turn.
+	client *http.Client
+
+	mu   sync.Mutex
+	sent map[string]time.Time // last alert sent, by fingerprint.
+}
+
+func (h *alertHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.a.min {
+		h.a.alert(r)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *alertHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	return &h2
+}
+
+func (h *alertHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	return &h2
+}
+
+// rebase returns a handler sending the same alerts around next: see Sub.
+func (h *alertHandler) rebase(next slog.Handler) slog.Handler {
+	return &alertHandler{Handler: next, a: h.a}
+}
+
+// alert sends an alert for r in the background, unless one with the same fingerprint was sent within the window.
+func (a *alerter) alert(r slog.Record) {
+	fp := a.meta.Service + "\x00" + r.Message
+	now := time.Now()
+	a.mu.Lock()
+	if last, ok := a.sent[fp]; ok && now.Sub(last) < a.window {
+		a.mu.Unlock()
+		return
+	}
+	a.sent[fp] = now
+	if len(a.sent) > 1024 { // forget expired fingerprints, so that a stream of distinct messages can't grow the map forever.
+		for k, last := range a.sent {
+			if now.Sub(last) >= a.window {
+				delete(a.sent, k)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	msg := plainValue(slog.String(slog.MessageKey, r.Message))
+	attrs := make(map[string]any, r.NumAttrs())
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs[attr.Key] = plainValue(attr)
+		return true
+	})
+	body, err := json.Marshal(map[string]any{
+		"fingerprint": fmt.Sprintf("%s: %s", a.meta.Service, msg),
+		"service":     a.meta.Service,
+		"env":         a.meta.Env,
+		"instance_id": a.meta.InstanceID,
+		"time":        r.Time.UTC(),
+		"level":       r.Level.String(),
+		"msg":         msg,
+		"attrs":       attrs,
+	})
+	if err != nil {
+		a.fail(err)
+		return
+	}
+	pending.Add(1) // see Flush.
+	health.alertsInFlight.Add(1)
+	go func() {
+		defer pending.Done()
+		defer health.alertsInFlight.Add(-1)
+		resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			a.fail(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			a.fail(fmt.Errorf("webhook responded %s", resp.Status))
+		}
+	}()
+}
+
+func (a *alerter) fail(err error) {
+	health.alertsFailed.Add(1)
+	r := slog.NewRecord(time.Now(), slog.LevelWarn, "failed to send webhook alert", 0)
+	r.AddAttrs(slog.String("err", err.Error()))
+	_ = a.log.Handle(context.Background(), r)
+}
@@ -0,0 +1,64 @@
+package rplog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitWebhookAlerts(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []map[string]any
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decoding alert: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, alert)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	flush := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Init(&Metadata{Service: "svc"}, io.Discard)
+	InitWebhookAlerts(srv.URL, slog.LevelError, time.Hour)
+	slog.Error("boom", "k", "v")
+	slog.Error("boom") // deduplicated within the window.
+	slog.Error("other")
+	slog.Warn("below the level")
+	flush()
+
+	mu.Lock()
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2: %v", len(alerts), alerts)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i]["msg"].(string) < alerts[j]["msg"].(string) })
+	if a := alerts[0]; a["msg"] != "boom" || a["service"] != "svc" || a["fingerprint"] != "svc: boom" || a["attrs"].(map[string]any)["k"] != "v" {
+		t.Errorf("alert = %v", a)
+	}
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	failed := health.alertsFailed.Load()
+	slog.Error("rejected")
+	flush()
+	if got := health.alertsFailed.Load() - failed; got != 1 {
+		t.Errorf("%d failed alerts counted, want 1", got)
+	}
+}